@@ -0,0 +1,277 @@
+// Copyright (c) 2022 The Decred developers
+// Use of this source code is governed by an ISC license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+const (
+	// maxExtractSize is the maximum number of bytes extracted from an
+	// archive. Releases are far smaller, this stops decompression bombs.
+	maxExtractSize = 4 << 30
+
+	// maxExtractFiles is the maximum number of entries extracted from an
+	// archive.
+	maxExtractFiles = 10000
+)
+
+var (
+	// errArchivePath is returned for entries that would be extracted
+	// outside of the destination directory.
+	errArchivePath = errors.New("illegal file path")
+
+	// errArchiveLink is returned for symlink and hardlink entries.
+	errArchiveLink = errors.New("links are not allowed")
+
+	// errArchiveType is returned for entries that are neither regular
+	// files nor directories.
+	errArchiveType = errors.New("unsupported entry type")
+
+	// errArchiveSize is returned when an archive exceeds maxExtractSize.
+	errArchiveSize = errors.New("extracted size limit exceeded")
+
+	// errArchiveFiles is returned when an archive exceeds maxExtractFiles.
+	errArchiveFiles = errors.New("file count limit exceeded")
+)
+
+// archiveFormat is the format of an archive as detected from its content.
+type archiveFormat int
+
+const (
+	formatUnknown archiveFormat = iota
+	formatZip
+	formatTar
+	formatTarGz
+	formatTarXz
+	formatTarZstd
+)
+
+// String satisfies the Stringer interface for archiveFormat.
+func (f archiveFormat) String() string {
+	switch f {
+	case formatZip:
+		return "zip"
+	case formatTar:
+		return "tar"
+	case formatTarGz:
+		return "tar.gz"
+	case formatTarXz:
+		return "tar.xz"
+	case formatTarZstd:
+		return "tar.zst"
+	}
+	return "unknown"
+}
+
+// archiveMagic lists the magic bytes, and their offset, that identify the
+// supported archive formats.
+var archiveMagic = []struct {
+	format archiveFormat
+	offset int
+	magic  []byte
+}{
+	{formatZip, 0, []byte("PK\x03\x04")},
+	{formatTarGz, 0, []byte{0x1f, 0x8b}},
+	{formatTarXz, 0, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+	{formatTarZstd, 0, []byte{0x28, 0xb5, 0x2f, 0xfd}},
+	{formatTar, 257, []byte("ustar")},
+}
+
+// detectArchive returns the format of the provided archive. The format is
+// determined by the content of the file, its name is ignored.
+func detectArchive(filename string) (archiveFormat, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return formatUnknown, err
+	}
+	defer f.Close()
+
+	header := make([]byte, 512)
+	n, err := io.ReadFull(f, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) &&
+		!errors.Is(err, io.EOF) {
+
+		return formatUnknown, err
+	}
+	header = header[:n]
+
+	for _, m := range archiveMagic {
+		end := m.offset + len(m.magic)
+		if end <= len(header) &&
+			bytes.Equal(header[m.offset:end], m.magic) {
+
+			return m.format, nil
+		}
+	}
+	return formatUnknown, nil
+}
+
+// untarFile extracts the provided tarball, which is compressed according to
+// format, to destination. See untar for the entries that are extracted.
+func untarFile(filename, destination string, format archiveFormat) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader
+	switch format {
+	case formatTar:
+		r = f
+	case formatTarGz:
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	case formatTarXz:
+		r, err = xz.NewReader(f)
+		if err != nil {
+			return err
+		}
+	case formatTarZstd:
+		// Keep memory use low, dcrinstall runs on small devices.
+		zr, err := zstd.NewReader(f, zstd.WithDecoderLowmem(true),
+			zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		r = zr
+	default:
+		return fmt.Errorf("Not a tarball: %v", format)
+	}
+
+	return untar(r, destination)
+}
+
+// archivePath returns the path an archive entry is extracted to. It returns
+// errArchivePath if the entry is absolute or escapes the destination. A
+// directory entry may be the destination itself, such as the "./" entry of
+// an archive created with 'tar -C dir .'.
+func archivePath(destination, name string, dir bool) (string, error) {
+	if name == "" || filepath.IsAbs(name) || strings.HasPrefix(name, "/") ||
+		filepath.VolumeName(name) != "" {
+
+		return "", fmt.Errorf("%w: %v", errArchivePath, name)
+	}
+	target := filepath.Join(destination, name)
+	clean := filepath.Clean(destination)
+	if dir && target == clean {
+		return target, nil
+	}
+	if !strings.HasPrefix(target, clean+string(os.PathSeparator)) {
+
+		return "", fmt.Errorf("%w: %v", errArchivePath, name)
+	}
+	return target, nil
+}
+
+// archiveMode returns the permissions an extracted file is created with.
+// Ownership and special bits are never taken from the archive. Files are
+// executable by everyone if they are executable by anyone in the archive and
+// never writable by anyone but the owner.
+func archiveMode(mode int64) os.FileMode {
+	if mode&0111 != 0 {
+		return 0755
+	}
+	return 0644
+}
+
+// untar extracts the tar stream r into destination. Entries that escape
+// destination, links and special files are rejected, the extracted size and
+// number of entries are limited and permissions are normalized. Every
+// violation is reported with a distinct error.
+func untar(r io.Reader, destination string) error {
+	var size int64
+	var files int
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break // end of archive
+			}
+			return err
+		}
+
+		files++
+		if files > maxExtractFiles {
+			return fmt.Errorf("%w: more than %v entries",
+				errArchiveFiles, maxExtractFiles)
+		}
+
+		log.Printf("Extracting: %v", hdr.Name)
+		target, err := archivePath(destination, hdr.Name,
+			hdr.Typeflag == tar.TypeDir)
+		if err != nil {
+			return err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			size += hdr.Size
+			if hdr.Size < 0 || size > maxExtractSize {
+				return fmt.Errorf("%w: more than %v bytes",
+					errArchiveSize, int64(maxExtractSize))
+			}
+
+			err := os.MkdirAll(filepath.Dir(target), 0755)
+			if err != nil {
+				return err
+			}
+			mode := archiveMode(hdr.Mode)
+			f, err := os.OpenFile(target,
+				os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+			if err != nil {
+				return err
+			}
+
+			// copy to file, the tar reader never returns more than
+			// hdr.Size bytes.
+			_, err = io.Copy(f, tr)
+			if err == nil {
+				// Normalize the mode of an existing file.
+				err = f.Chmod(mode)
+			}
+			if err != nil {
+				f.Close()
+				return err
+			}
+
+			if err := f.Close(); err != nil {
+				return err
+			}
+		case tar.TypeSymlink, tar.TypeLink:
+			return fmt.Errorf("%w: %v -> %v", errArchiveLink,
+				hdr.Name, hdr.Linkname)
+		case tar.TypeXGlobalHeader:
+			// PAX global header, nothing to extract.
+		default:
+			return fmt.Errorf("%w: %v (type %q)", errArchiveType,
+				hdr.Name, hdr.Typeflag)
+		}
+	}
+
+	return nil
+}
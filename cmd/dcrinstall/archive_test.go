@@ -0,0 +1,230 @@
+// Copyright (c) 2022 The Decred developers
+// Use of this source code is governed by an ISC license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// tarEntry is an entry of a tarball that is created by a test.
+type tarEntry struct {
+	name     string
+	typeflag byte
+	linkname string
+	mode     int64
+	content  string
+}
+
+// createTar returns a tar stream with the provided entries.
+func createTar(t *testing.T, entries []tarEntry) *bytes.Buffer {
+	t.Helper()
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := &tar.Header{
+			Name:     e.name,
+			Typeflag: e.typeflag,
+			Linkname: e.linkname,
+			Mode:     e.mode,
+			Size:     int64(len(e.content)),
+		}
+		if e.typeflag != tar.TypeReg {
+			hdr.Size = 0
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+// TestArchivePath ensures entries can't escape the destination directory.
+func TestArchivePath(t *testing.T) {
+	dest := filepath.Join("tmp", "dest")
+	tests := []struct {
+		name  string
+		entry string
+		dir   bool
+		want  string
+		err   error
+	}{
+		{"file", "decred/dcrd", false, filepath.Join(dest, "decred",
+			"dcrd"), nil},
+		{"dot file", "./decred/dcrd", false, filepath.Join(dest,
+			"decred", "dcrd"), nil},
+		{"dot dir", "./", true, dest, nil},
+		{"dot", ".", true, dest, nil},
+		{"dot file entry", "./", false, "", errArchivePath},
+		{"empty", "", false, "", errArchivePath},
+		{"absolute", "/etc/passwd", false, "", errArchivePath},
+		{"absolute dir", "/", true, "", errArchivePath},
+		{"traversal", "../passwd", false, "", errArchivePath},
+		{"traversal dir", "..", true, "", errArchivePath},
+		{"nested traversal", "decred/../../passwd", false, "",
+			errArchivePath},
+		{"sibling", "../dest2/passwd", false, "", errArchivePath},
+	}
+	for _, test := range tests {
+		got, err := archivePath(dest, test.entry, test.dir)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%v: got error %v, want %v", test.name, err,
+				test.err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%v: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+// TestUntar ensures tarballs are extracted with normalized permissions and
+// that every violation is rejected with its error.
+func TestUntar(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []tarEntry
+		err     error
+	}{
+		{"tar -C dir .", []tarEntry{
+			{name: "./", typeflag: tar.TypeDir, mode: 0755},
+			{name: "./decred/", typeflag: tar.TypeDir, mode: 0755},
+			{name: "./decred/dcrd", typeflag: tar.TypeReg,
+				mode: 04775, content: "dcrd"},
+		}, nil},
+		{"traversal", []tarEntry{
+			{name: "../dcrd", typeflag: tar.TypeReg, mode: 0755,
+				content: "dcrd"},
+		}, errArchivePath},
+		{"absolute", []tarEntry{
+			{name: "/tmp/dcrd", typeflag: tar.TypeReg, mode: 0755,
+				content: "dcrd"},
+		}, errArchivePath},
+		{"symlink", []tarEntry{
+			{name: "dcrd", typeflag: tar.TypeSymlink,
+				linkname: "/usr/bin/dcrd"},
+		}, errArchiveLink},
+		{"hardlink", []tarEntry{
+			{name: "dcrd", typeflag: tar.TypeLink,
+				linkname: "/etc/passwd"},
+		}, errArchiveLink},
+		{"fifo", []tarEntry{
+			{name: "dcrd", typeflag: tar.TypeFifo},
+		}, errArchiveType},
+	}
+	for _, test := range tests {
+		dest := t.TempDir()
+		err := untar(createTar(t, test.entries), dest)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%v: got error %v, want %v", test.name, err,
+				test.err)
+		}
+	}
+
+	dest := t.TempDir()
+	err := untar(createTar(t, tests[0].entries), dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(filepath.Join(dest, "decred", "dcrd"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode() != 0755 {
+		t.Errorf("mode: got %v, want %v", fi.Mode(), os.FileMode(0755))
+	}
+}
+
+// TestUntarLimits ensures the extracted size and number of entries are
+// limited.
+func TestUntarLimits(t *testing.T) {
+	// The size is checked before the content is read, so only the header
+	// of the oversized file is needed.
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	err := tw.WriteHeader(&tar.Header{
+		Name:     "dcrd",
+		Typeflag: tar.TypeReg,
+		Mode:     0755,
+		Size:     maxExtractSize + 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = untar(&buf, t.TempDir())
+	if !errors.Is(err, errArchiveSize) {
+		t.Errorf("size: got error %v, want %v", err, errArchiveSize)
+	}
+
+	entries := make([]tarEntry, maxExtractFiles+1)
+	for k := range entries {
+		entries[k] = tarEntry{name: "decred/", typeflag: tar.TypeDir,
+			mode: 0755}
+	}
+	err = untar(createTar(t, entries), t.TempDir())
+	if !errors.Is(err, errArchiveFiles) {
+		t.Errorf("count: got error %v, want %v", err, errArchiveFiles)
+	}
+}
+
+// TestUnzip ensures zip files are subject to the same rules as tarballs.
+func TestUnzip(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry string
+		mode  os.FileMode
+		err   error
+	}{
+		{"dot dir", "./", os.ModeDir | 0755, nil},
+		{"file", "decred/dcrd.exe", 0755, nil},
+		{"traversal", "../dcrd.exe", 0755, errArchivePath},
+		{"absolute", "/dcrd.exe", 0755, errArchivePath},
+		{"symlink", "dcrd.exe", os.ModeSymlink | 0777, errArchiveLink},
+	}
+	for _, test := range tests {
+		dir := t.TempDir()
+		src := filepath.Join(dir, "test.zip")
+		f, err := os.Create(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		zw := zip.NewWriter(f)
+		hdr := &zip.FileHeader{Name: test.entry, Method: zip.Store}
+		hdr.SetMode(test.mode)
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !test.mode.IsDir() {
+			if _, err := w.Write([]byte("dcrd")); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = unzip(src, filepath.Join(dir, "dest"))
+		if !errors.Is(err, test.err) {
+			t.Errorf("%v: got error %v, want %v", test.name, err,
+				test.err)
+		}
+	}
+}
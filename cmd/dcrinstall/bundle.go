@@ -0,0 +1,264 @@
+// Copyright (c) 2022 The Decred developers
+// Use of this source code is governed by an ISC license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"sync"
+)
+
+// preconditionMode selects which installation preconditions of a bundle are
+// asserted.
+type preconditionMode int
+
+const (
+	// modeInstall asserts the preconditions of an install or upgrade,
+	// which --repair and --allow-downgrade relax.
+	modeInstall preconditionMode = iota
+
+	// modeRollback asserts the preconditions of a rollback, which is an
+	// explicit downgrade that only replaces binaries.
+	modeRollback
+)
+
+// preconditionsFunc asserts that a bundle can be installed in the provided
+// mode.
+type preconditionsFunc func(*bundleInfo, preconditionMode) error
+
+// bundleInfo describes a bundle that dcrinstall installs and records its
+// download state. Every bundle only modifies its own state so that bundles
+// can be downloaded and verified concurrently.
+type bundleInfo struct {
+	Name          string            // Name used on the command line
+	Title         string            // Name used in messages
+	Prefix        string            // Prefix of the extracted bundle directory
+	Files         []decredFiles     // Files contained in the bundle
+	Preconditions preconditionsFunc // Installation preconditions
+
+	// Download state
+	ManifestURI       string // Bundle manifest URI
+	ManifestDigest    string // Bundle manifest digest, if used
+	LatestVersion     string // Bundle version in the latest manifest, if used
+	ManifestFilename  string // Downloaded manifest
+	SignatureFilename string // Downloaded manifest signature
+	Version           string // Bundle version found in the manifest
+	DownloadURI       string // Bundle download URI
+	BundleFilename    string // Downloaded bundle
+
+	// RPC credentials of the existing configuration files that a repair
+	// uses for generated ones instead of the generated credentials.
+	RPCUser string
+	RPCPass string
+}
+
+// rpcCredentials returns the RPC user and password that are used in the
+// generated configuration files of the bundle.
+func (b *bundleInfo) rpcCredentials() (string, string) {
+	if b.RPCUser != "" {
+		return b.RPCUser, b.RPCPass
+	}
+	return username, password
+}
+
+var (
+	decredBundle = &bundleInfo{
+		Name:          "decred",
+		Title:         "Decred",
+		Prefix:        "decred",
+		Files:         df,
+		Preconditions: preconditionsDecredInstall,
+	}
+	dcrdexBundle = &bundleInfo{
+		Name:          "dcrdex",
+		Title:         "DCRDEX",
+		Prefix:        "bisonwallet",
+		Files:         dexf,
+		Preconditions: preconditionsDcrdexInstall,
+	}
+
+	bundles = []*bundleInfo{decredBundle, dcrdexBundle}
+)
+
+// findBundle returns the bundle with the provided name.
+func findBundle(name string) (*bundleInfo, error) {
+	for _, b := range bundles {
+		if b.Name == name {
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown bundle: %v", name)
+}
+
+// bundleDir returns the name of the extracted bundle directory of the
+// provided version.
+func (b *bundleInfo) bundleDir(version string) string {
+	return b.Prefix + "-" + tuple + "-" + version
+}
+
+// seenBefore returns true if the bundle of the current version has been
+// extracted before.
+func (b *bundleInfo) seenBefore() bool {
+	return exists(filepath.Join(destination, b.bundleDir(b.Version)))
+}
+
+// downloadManifest downloads the bundle manifest and verifies its digest, if
+// known, and its signature. It then determines the bundle version for the
+// selected tuple and returns the digest and filename of the bundle.
+func (b *bundleInfo) downloadManifest() (string, string, error) {
+	// Download the manifest
+	b.ManifestFilename = filepath.Join(tmpDir,
+		filepath.Base(b.ManifestURI))
+	var err error
+	if b.ManifestDigest != "" {
+		// Optional digest was set so check it
+		err = downloadVerified(b.ManifestURI, b.ManifestFilename,
+			b.ManifestDigest)
+	} else {
+		err = DownloadFile(b.ManifestURI, b.ManifestFilename)
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("Download %v manifest file: %v",
+			b.Name, err)
+	}
+	b.DownloadURI, err = getDownloadURI(b.ManifestURI)
+	if err != nil {
+		return "", "", fmt.Errorf("Get download URI: %v", err)
+	}
+
+	if !skipPGP {
+		// Download the manifest signature
+		b.SignatureFilename = b.ManifestFilename + ".asc"
+		err = DownloadFile(b.ManifestURI+".asc", b.SignatureFilename)
+		if err != nil {
+			return "", "", fmt.Errorf("Download manifest "+
+				"signature file: %v", err)
+		}
+
+		// Verify manifest signature
+		err = pgpVerify(b.SignatureFilename, b.ManifestFilename)
+		if err != nil {
+			return "", "", fmt.Errorf("manifest PGP signature "+
+				"incorrect: %v", err)
+		}
+	}
+
+	// XXX hack around extractSemVer not working properly by feeding it the
+	// filename instead of figuring it out from the URL.
+	digest, filename, err := findOS(tuple, b.ManifestFilename)
+	if err != nil {
+		return "", "", fmt.Errorf("Find tuple: %v", err)
+	}
+	ver, err := extractSemVer(filepath.Base(filename))
+	if err != nil {
+		return "", "", fmt.Errorf("Extract %v semver from "+
+			"manifest filename %v", b.Name, err)
+	}
+	b.Version = ver.String()
+	if b.LatestVersion != "" && b.LatestVersion != b.Version {
+		return "", "", fmt.Errorf("%v manifest contains version %v, "+
+			"latest manifest lists %v", b.Name, b.Version,
+			b.LatestVersion)
+	}
+	log.Printf("Attempting to upgrade to %v version: %v", b.Title,
+		b.Version)
+
+	return digest, filename, nil
+}
+
+// downloadBundle downloads the bundle into the temporary directory, or takes
+// it from the download cache. It also verifies the that the digest of the
+// downloaded file matches the value in the manifest.
+func (b *bundleInfo) downloadBundle(digest, filename string) error {
+	b.BundleFilename = filepath.Join(tmpDir, filename)
+	return downloadVerified(b.DownloadURI+filename, b.BundleFilename,
+		digest)
+}
+
+// checkDowngrade returns an error when the bundle version is older than the
+// installed version unless downgrades are allowed. Database upgrades of dcrd
+// and dcrwallet are one-way so an older release may not be able to use them.
+func (b *bundleInfo) checkDowngrade() error {
+	installed := b.activeVersion()
+	if installed == "" {
+		return nil
+	}
+	c, err := compareSemVer(b.Version, installed)
+	if err != nil {
+		return fmt.Errorf("Compare %v versions: %v", b.Name, err)
+	}
+	if c >= 0 {
+		return nil
+	}
+	if !allowDowngrade {
+		return fmt.Errorf("refusing to downgrade %v from %v to %v, "+
+			"use --allow-downgrade to override", b.Name, installed,
+			b.Version)
+	}
+	log.Printf("Downgrading %v from %v to %v", b.Name, installed,
+		b.Version)
+	return nil
+}
+
+// downloadAndVerify downloads, verifies and asserts that the bundle can be
+// safely upgraded. This function asserts that all preconditions are met
+// before being able to proceed with the bundle install.
+func (b *bundleInfo) downloadAndVerify() error {
+	digest, filename, err := b.downloadManifest()
+	if err != nil {
+		return err
+	}
+
+	err = b.checkDowngrade()
+	if err != nil {
+		return err
+	}
+
+	// Don't download bundle if it has been extracted.
+	if forceDownload || !b.seenBefore() {
+		err = b.downloadBundle(digest, filename)
+		if err != nil {
+			return fmt.Errorf("Download %v bundle: %v", b.Name, err)
+		}
+
+		err = extract(b.BundleFilename, extractDestination())
+		if err != nil {
+			return fmt.Errorf("Extract %v bundle: %v", b.Name, err)
+		}
+	} else {
+		log.Printf("Using cached archive: %v", filename)
+	}
+
+	err = b.Preconditions(b, modeInstall)
+	if err != nil {
+		return fmt.Errorf("Pre %v install: %v", b.Name, err)
+	}
+
+	return nil
+}
+
+// downloadAndVerifyBundles downloads and verifies all bundles concurrently.
+func downloadAndVerifyBundles() error {
+	errs := make([]error, len(bundles))
+	var wg sync.WaitGroup
+	for k, b := range bundles {
+		wg.Add(1)
+		go func(k int, b *bundleInfo) {
+			defer wg.Done()
+			errs[k] = b.downloadAndVerify()
+		}(k, b)
+	}
+	wg.Wait()
+
+	for k, err := range errs {
+		if err != nil {
+			return fmt.Errorf("%v download and verify: %v",
+				bundles[k].Title, err)
+		}
+	}
+
+	return nil
+}
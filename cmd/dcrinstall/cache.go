@@ -0,0 +1,276 @@
+// Copyright (c) 2022 The Decred developers
+// Use of this source code is governed by an ISC license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+)
+
+// defaultCacheDir returns the default download cache directory or an empty
+// string, which disables the cache, if there is no user cache directory.
+func defaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "dcrinstall")
+}
+
+// validDigest returns true if digest is a hex encoded SHA256 digest. Only
+// valid digests are used as a path component of the cache.
+func validDigest(digest string) bool {
+	b, err := hex.DecodeString(digest)
+	return err == nil && len(b) == sha256.Size
+}
+
+// cachePath returns the path of the cache entry of the file with the provided
+// digest and name. Entries are keyed by digest, the name is only kept to
+// make the cache human readable.
+func cachePath(digest, name string) string {
+	return filepath.Join(cacheDir, digest, name)
+}
+
+// downloadVerified downloads uri to filename and verifies that it matches
+// the provided digest. The file is hashed while it is downloaded and filename
+// is only created once it matched. When the download cache is enabled the file
+// is downloaded into the cache, where an interrupted download resumes on the
+// next run, and a cached file that matches the digest is used without
+// downloading it again. A dry run uses the cache but never modifies it.
+func downloadVerified(uri, filename, digest string) error {
+	if !validDigest(digest) {
+		return fmt.Errorf("invalid digest for %v: %q", uri, digest)
+	}
+	// Manifests may use upper case hex, the cache is keyed by lower case.
+	digest = strings.ToLower(digest)
+	if cacheDir == "" {
+		return downloadDigest(uri, filename, digest)
+	}
+
+	name := path.Base(uri)
+	if name == "." || name == ".." || name == "/" {
+		return fmt.Errorf("invalid file name: %v", uri)
+	}
+	cached := cachePath(digest, name)
+	if exists(cached) {
+		// Verify the cached file while copying it.
+		d, err := copyFileHashed(filename+".tmp", cached)
+		if err != nil {
+			os.Remove(filename + ".tmp")
+			return err
+		}
+		if hex.EncodeToString(d) == digest {
+			log.Printf("Using cached file: %v", cached)
+			if !dryRun {
+				now := time.Now()
+				err = os.Chtimes(cached, now, now)
+				if err != nil {
+					return err
+				}
+			}
+			recordDownload(cached)
+			return os.Rename(filename+".tmp", filename)
+		}
+		os.Remove(filename + ".tmp")
+		if !dryRun {
+			log.Printf("Removing corrupt cached file: %v", cached)
+			os.Remove(cached)
+		}
+	}
+	if dryRun {
+		return downloadDigest(uri, filename, digest)
+	}
+
+	err := os.MkdirAll(filepath.Dir(cached), 0700)
+	if err != nil {
+		return err
+	}
+	err = downloadDigest(uri, cached, digest)
+	if err != nil {
+		return err
+	}
+	err = copyFile(filename+".tmp", cached)
+	if err != nil {
+		os.Remove(filename + ".tmp")
+		return err
+	}
+
+	return os.Rename(filename+".tmp", filename)
+}
+
+// cacheEntry is a file in the download cache.
+type cacheEntry struct {
+	Digest  string
+	Name    string
+	Size    int64
+	Used    time.Time // Time the entry was downloaded or last used
+	Partial bool      // Interrupted download
+}
+
+// path returns the path of the cache entry.
+func (e *cacheEntry) path() string {
+	name := e.Name
+	if e.Partial {
+		name += ".tmp"
+	}
+	return cachePath(e.Digest, name)
+}
+
+// cacheEntries returns all entries of the download cache sorted by name.
+func cacheEntries() ([]cacheEntry, error) {
+	dirs, err := os.ReadDir(cacheDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var entries []cacheEntry
+	for _, d := range dirs {
+		if !validDigest(d.Name()) || !d.IsDir() {
+			continue
+		}
+		files, err := os.ReadDir(filepath.Join(cacheDir, d.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			fi, err := f.Info()
+			if err != nil {
+				return nil, err
+			}
+			if !fi.Mode().IsRegular() {
+				continue
+			}
+			e := cacheEntry{
+				Digest: d.Name(),
+				Name:   f.Name(),
+				Size:   fi.Size(),
+				Used:   fi.ModTime(),
+			}
+			if strings.HasSuffix(e.Name, ".tmp") {
+				e.Name = strings.TrimSuffix(e.Name, ".tmp")
+				e.Partial = true
+			}
+			entries = append(entries, e)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+
+	return entries, nil
+}
+
+// cacheList prints the entries of the download cache.
+func cacheList() error {
+	entries, err := cacheEntries()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Cache directory: %v\n\n", cacheDir)
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "NAME\tSIZE\tLAST USED\tSHA256\n")
+	var total int64
+	for _, e := range entries {
+		name := e.Name
+		if e.Partial {
+			name += " (partial)"
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", name,
+			humanize.Bytes(uint64(e.Size)),
+			e.Used.Format("2006-01-02 15:04"), e.Digest)
+		total += e.Size
+	}
+	w.Flush()
+	fmt.Printf("\n%v entries, %v\n", len(entries),
+		humanize.Bytes(uint64(total)))
+
+	return nil
+}
+
+// cachePrune removes the entries of the download cache that have not been
+// used for the provided duration, or all entries.
+func cachePrune(age time.Duration, all bool) error {
+	entries, err := cacheEntries()
+	if err != nil {
+		return err
+	}
+
+	cutoff := time.Now().Add(-age)
+	var removed int
+	var freed int64
+	for _, e := range entries {
+		if !all && e.Used.After(cutoff) {
+			continue
+		}
+		log.Printf("Removing cached file: %v", e.path())
+		err = os.Remove(e.path())
+		if err != nil {
+			return err
+		}
+		removed++
+		freed += e.Size
+
+		// Remove the digest directory once it is empty.
+		dir := filepath.Dir(e.path())
+		if d, err := os.ReadDir(dir); err == nil && len(d) == 0 {
+			os.Remove(dir)
+		}
+	}
+	fmt.Printf("Removed %v entries, freed %v\n", removed,
+		humanize.Bytes(uint64(freed)))
+
+	return nil
+}
+
+// cache lists or prunes the download cache.
+func cache(args []string) error {
+	usage := fmt.Errorf("usage: cache list | cache prune [-age " +
+		"<duration>] [-all]")
+	if cacheDir == "" {
+		return fmt.Errorf("download cache is disabled")
+	}
+	if len(args) == 0 {
+		return usage
+	}
+
+	switch args[0] {
+	case "list":
+		if len(args) != 1 {
+			return usage
+		}
+		return cacheList()
+	case "prune":
+		fs := flag.NewFlagSet("prune", flag.ContinueOnError)
+		ageF := fs.Duration("age", 30*24*time.Hour, "Remove entries "+
+			"that have not been used for this long")
+		allF := fs.Bool("all", false, "Remove all entries")
+		err := fs.Parse(args[1:])
+		if err != nil {
+			return err
+		}
+		if fs.NArg() != 0 {
+			return usage
+		}
+		return cachePrune(*ageF, *allF)
+	}
+
+	return usage
+}
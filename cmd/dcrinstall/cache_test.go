@@ -0,0 +1,79 @@
+// Copyright (c) 2022 The Decred developers
+// Use of this source code is governed by an ISC license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestValidDigest ensures only hex encoded SHA256 digests are used as cache
+// path components.
+func TestValidDigest(t *testing.T) {
+	digest := strings.Repeat("ab", 32)
+	tests := []struct {
+		digest string
+		want   bool
+	}{
+		{digest, true},
+		{strings.ToUpper(digest), true},
+		{digest[:62], false},
+		{digest + "ab", false},
+		{"", false},
+		{"../../x", false},
+		{strings.Repeat("zz", 32), false},
+	}
+	for _, test := range tests {
+		if got := validDigest(test.digest); got != test.want {
+			t.Errorf("%q: got %v, want %v", test.digest, got,
+				test.want)
+		}
+	}
+}
+
+// TestDownloadVerifiedCache ensures verified downloads are cached and reused,
+// also when the manifest uses upper case hex digests.
+func TestDownloadVerifiedCache(t *testing.T) {
+	oldCacheDir, oldDownloaded := cacheDir, downloadedURIs
+	t.Cleanup(func() {
+		cacheDir, downloadedURIs = oldCacheDir, oldDownloaded
+	})
+	dir := t.TempDir()
+	cacheDir = filepath.Join(dir, "cache")
+	downloadedURIs = nil
+
+	src := filepath.Join(dir, "decred-v2.1.0.tar.gz")
+	writeTestFile(t, src, "bundle")
+	d := sha256.Sum256([]byte("bundle"))
+	digest := strings.ToUpper(hex.EncodeToString(d[:]))
+	cached := cachePath(strings.ToLower(digest), filepath.Base(src))
+
+	for i := 0; i < 2; i++ {
+		filename := filepath.Join(dir, "download")
+		err := downloadVerified("file://"+src, filename, digest)
+		if err != nil {
+			t.Fatalf("download %v: %v", i, err)
+		}
+		if !exists(cached) {
+			t.Fatalf("download %v: not cached: %v", i, cached)
+		}
+		os.Remove(filename)
+	}
+	if n := len(downloadedURIs); n == 0 ||
+		downloadedURIs[n-1] != cached {
+
+		t.Errorf("cached file not used: %v", downloadedURIs)
+	}
+
+	err := downloadVerified("file://"+src, filepath.Join(dir, "x"),
+		"../../x")
+	if err == nil {
+		t.Errorf("invalid digest: expected error")
+	}
+}
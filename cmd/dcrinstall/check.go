@@ -0,0 +1,136 @@
+// Copyright (c) 2022 The Decred developers
+// Use of this source code is governed by an ISC license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Exit codes of the check command.
+const (
+	exitUpToDate        = 0  // Everything is installed and up to date
+	exitUpdateAvailable = 10 // A newer release is available
+	exitInconsistent    = 20 // The installation is inconsistent
+)
+
+// exitError is an error that carries the process exit code. A nil err exits
+// silently.
+type exitError struct {
+	code int
+	err  error
+}
+
+// Error satisfies the error interface for exitError.
+func (e exitError) Error() string {
+	if e.err == nil {
+		return fmt.Sprintf("exit code %v", e.code)
+	}
+	return e.err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e exitError) Unwrap() error {
+	return e.err
+}
+
+// checkBundle compares the installed version of a bundle with the latest
+// version. It returns the installed version, a description of the state and
+// the corresponding exit code.
+func checkBundle(bs *bundleStatus) (string, string, int) {
+	var missing []string
+	versions := make(map[string][]string)
+	for _, f := range bs.Files {
+		if !f.Installed {
+			missing = append(missing, f.Name)
+			continue
+		}
+		if f.Version != "" {
+			versions[f.Version] = append(versions[f.Version], f.Name)
+		}
+	}
+
+	switch {
+	case len(missing) == len(bs.Files):
+		return "", "not installed", exitUpdateAvailable
+	case len(missing) > 0:
+		return "", fmt.Sprintf("inconsistent, not installed: %v",
+			strings.Join(missing, ", ")), exitInconsistent
+	case len(versions) > 1:
+		return "", fmt.Sprintf("inconsistent, mixed versions: %v",
+			formatVersions(versions)), exitInconsistent
+	}
+
+	// Binaries can't be asked for their version on foreign OS-Arch
+	// tuples, use the recorded version instead.
+	installed := bs.Active
+	for v := range versions {
+		installed = v
+	}
+	switch {
+	case installed == "":
+		return "", "installed version unknown", exitInconsistent
+	case installed == bs.Latest:
+		return installed, "up to date", exitUpToDate
+	}
+	c, err := compareSemVer(installed, bs.Latest)
+	switch {
+	case err != nil:
+		return installed, fmt.Sprintf("invalid version: %v", err),
+			exitInconsistent
+	case c > 0:
+		return installed, "newer than latest", exitUpToDate
+	case c == 0:
+		return installed, "up to date", exitUpToDate
+	}
+	return installed, "update available", exitUpdateAvailable
+}
+
+// check downloads and verifies the latest manifest and the bundle manifests
+// and compares the versions they contain with the installed versions. It
+// returns an exitError with exitUpdateAvailable when an update is available
+// or exitInconsistent when the installation is inconsistent.
+func check(args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("unexpected arguments: %v", args)
+	}
+
+	var err error
+	tmpDir, err = scratchDir()
+	if err != nil {
+		return err
+	}
+	defer removeScratchDir(tmpDir)
+
+	err = resolveManifests()
+	if err != nil {
+		return err
+	}
+	for _, b := range bundles {
+		_, _, err = b.downloadManifest()
+		if err != nil {
+			return fmt.Errorf("%v manifest: %v", b.Title, err)
+		}
+	}
+
+	r := inventory()
+	code := exitUpToDate
+	for k := range r.Bundles {
+		bs := &r.Bundles[k]
+		installed, state, c := checkBundle(bs)
+		if !quiet {
+			fmt.Printf("%v: installed %v, latest %v: %v\n", bs.Name,
+				valueOr(installed, "-"), bs.Latest, state)
+		}
+		if c > code {
+			code = c
+		}
+	}
+	if code == exitUpToDate {
+		return nil
+	}
+
+	return exitError{code: code}
+}
@@ -8,25 +8,45 @@ import (
 	"bufio"
 	"bytes"
 	"errors"
+	"fmt"
 	"io"
+	"log"
 	"os"
 	"strings"
 )
 
+// applicationOptions is the config section of options that are not part of
+// a named group.
+const applicationOptions = "[Application Options]"
+
+// errOverrideNotFound is returned when a config doesn't contain an entry that
+// must be overridden.
+var errOverrideNotFound = errors.New("configuration entry not found")
+
 // override describes an entry (name) in a config file that has to be overridden
-// by "content".
+// by "content". When add is set and the config doesn't contain the entry it
+// is appended instead. When required is set and the config doesn't contain
+// the entry the config can't be generated.
 type override struct {
-	name    string
-	content string
+	name     string
+	content  string
+	add      bool
+	required bool
 }
 
 func createConfigNormal(br *bufio.Reader, overrides []override) (string, error) {
 	rv := ""
 
+	found := make([]bool, len(overrides))
 	for {
 		line, err := br.ReadString('\n')
 		if errors.Is(err, io.EOF) {
-			break
+			if line == "" {
+				break
+			}
+			line += "\n"
+		} else if err != nil {
+			return "", err
 		}
 
 		for k := range overrides {
@@ -35,11 +55,48 @@ func createConfigNormal(br *bufio.Reader, overrides []override) (string, error)
 			}
 			line = strings.TrimLeft(overrides[k].name, ";# ") +
 				overrides[k].content + "\n"
+			found[k] = true
 		}
 
 		rv += line
 	}
 
+	// Add entries that the config doesn't contain to the application
+	// options, which is where applications expect options that are not
+	// part of a named group.
+	lines := strings.Split(strings.TrimSuffix(rv, "\n"), "\n")
+	section := ""
+	for _, l := range lines {
+		l = strings.TrimSpace(l)
+		if strings.HasPrefix(l, "[") && strings.HasSuffix(l, "]") {
+			section = applicationOptions
+			break
+		}
+	}
+	added := false
+	for k := range overrides {
+		if found[k] {
+			continue
+		}
+		if overrides[k].required {
+			return "", fmt.Errorf("%w: %v", errOverrideNotFound,
+				strings.TrimSuffix(strings.TrimLeft(
+					overrides[k].name, ";# "), "="))
+		}
+		if !overrides[k].add {
+			continue
+		}
+		entry := strings.TrimLeft(overrides[k].name, ";# ")
+		log.Printf("Adding to configuration: %v",
+			strings.TrimSuffix(entry, "="))
+		lines = insertInSection(lines, section,
+			entry+overrides[k].content)
+		added = true
+	}
+	if added {
+		rv = strings.Join(lines, "\n") + "\n"
+	}
+
 	return rv, nil
 }
 
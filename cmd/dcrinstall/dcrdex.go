@@ -32,38 +32,16 @@ var (
 	}
 )
 
-// extractDcrdexBundle extracts the dcrdex bundle into the destination
-// directory.
-func extractDcrdexBundle() error {
-	return extract(dcrdexBundleFilename, destination)
-}
-
-// downloadDcrdexBundle downloads the dcrdex bundle into the temporary
-// directory. It also verifies the that the digest of the downloaded file
-// matches the value in the manifest.
-func downloadDcrdexBundle(digest, filename string) error {
-	// Download bundle
-	dcrdexBundleFilename = filepath.Join(tmpDir, filename)
-	err := DownloadFile(dcrdexDownloadURI+filename, dcrdexBundleFilename)
-	if err != nil {
-		return fmt.Errorf("Download dcrdex bundle: %v", err)
-	}
-
-	// Verify digest
-	err = sha256Verify(dcrdexBundleFilename, digest)
-	if err != nil {
-		return fmt.Errorf("SHA256 verification failed: %v", err)
-	}
-
-	return nil
-}
-
 // preconditionsDcrdexInstall determines if the tool is capable of installing
 // the dcrdex bundle. It asserts that:
 //   - no dcrdex daemons are running
 //   - all the installed files have the same version
 //   - either all or none of the config files exist
-func preconditionsDcrdexInstall() error {
+//
+// A rollback only replaces binaries so it installs every binary at the
+// rollback version regardless of their versions and doesn't check the config
+// files.
+func preconditionsDcrdexInstall(b *bundleInfo, mode preconditionMode) error {
 	if runtimeTuple() != tuple {
 		log.Printf("DCRDEX bundle installation on foreign OS, " +
 			"skipping runtime checks")
@@ -126,12 +104,28 @@ func preconditionsDcrdexInstall() error {
 	}
 
 	// Determine if everything or nothing is installed
-	if currentlyInstalled != 0 && currentlyInstalled != expectedInstalled {
-		return fmt.Errorf("dcrinstall requires all or none of the "+
-			"binary files to be installed. This is "+
-			"to prevent improper installations or upgrades. This "+
-			"upgrade/install requires human intervention.\n\n%v",
-			printConfigError(installedBins, notInstalledBins))
+	if currentlyInstalled != 0 && currentlyInstalled != expectedInstalled &&
+		mode != modeRollback {
+
+		if !repair {
+			return fmt.Errorf("dcrinstall requires all or none of "+
+				"the binary files to be installed. This is "+
+				"to prevent improper installations or upgrades. "+
+				"This upgrade/install requires human "+
+				"intervention or --repair to install the missing "+
+				"binaries.\n\n%v",
+				printConfigError(installedBins, notInstalledBins))
+		}
+		b.repairBinaries(installedBins, notInstalledBins)
+	}
+
+	// Determine if all binaries have the same version
+	err := b.checkMixedVersions(currentVersion, mode)
+	if err != nil {
+		return err
+	}
+	if mode == modeRollback {
+		return nil
 	}
 
 	// Install config files if applicable
@@ -160,11 +154,18 @@ func preconditionsDcrdexInstall() error {
 	}
 
 	if currentConfigFiles != 0 && currentConfigFiles != expectedConfigFiles {
-		return fmt.Errorf("dcrinstall requires all or none of the "+
-			"configuration files to be installed. This is "+
-			"to prevent improper installations or upgrades. This "+
-			"upgrade/install requires human intervention.\n\n%v",
-			printConfigError(installedConfigs, notInstalledConfigs))
+		if !repair {
+			return fmt.Errorf("dcrinstall requires all or none of "+
+				"the configuration files to be installed. This "+
+				"is to prevent improper installations or "+
+				"upgrades. This upgrade/install requires human "+
+				"intervention or --repair to generate the "+
+				"missing configuration files.\n\n%v",
+				printConfigError(installedConfigs,
+					notInstalledConfigs))
+		}
+		b.repairConfigs(installedConfigs, notInstalledConfigs,
+			bundleCredentials(installedConfigs))
 	}
 
 	// We can now create config files in their respective directories and
@@ -173,87 +174,22 @@ func preconditionsDcrdexInstall() error {
 	return nil
 }
 
-// dcrdexDownloadAndVerify downloads, verifies and asserts that the dcrdex
-// bundle can be safely upgraded. This function asserts that all preconditions
-// are met before being able to proceed with the dcrdex bundle install.
-func dcrdexDownloadAndVerify() error {
-	// Download the dcrdex manifest
-	manifestDcrdexFilename = filepath.Join(tmpDir,
-		filepath.Base(dcrdexManifestURI))
-	err := DownloadFile(dcrdexManifestURI, manifestDcrdexFilename)
-	if err != nil {
-		return fmt.Errorf("Download dcrdex manifest file: %v", err)
-	}
-	if dcrdexManifestDigest != "" {
-		// Optional digest was set so check it
-		err = sha256Verify(manifestDcrdexFilename, dcrdexManifestDigest)
-		if err != nil {
-			return fmt.Errorf("SHA256 of dcrdex manifest "+
-				"verification failed: %v", err)
-		}
-	}
-	dcrdexDownloadURI, err = getDownloadURI(dcrdexManifestURI)
-	if err != nil {
-		return fmt.Errorf("Get download URI: %v", err)
-	}
-
-	if !skipPGP {
-		// Download the dcrdex manifest signature
-		manifestDcrdexSignatureFilename = filepath.Join(tmpDir,
-			filepath.Base(dcrdexManifestURI)+".asc")
-		err = DownloadFile(dcrdexManifestURI+".asc",
-			manifestDcrdexSignatureFilename)
-		if err != nil {
-			return fmt.Errorf("Download manifest signature file: "+
-				"%v", err)
-		}
-
-		// Verify dcrdex manifest signature
-		err = pgpVerify(manifestDcrdexSignatureFilename,
-			manifestDcrdexFilename, dcrinstallPubkey)
-		if err != nil {
-			return fmt.Errorf("manifest PGP signature incorrect: "+
-				"%v", err)
+// dcrdexConfigOverrides returns the overrides that are applied to the sample
+// config of the provided dcrdex binary.
+func dcrdexConfigOverrides(name string) []override {
+	user, pass := dcrdexBundle.rpcCredentials()
+	var overrides []override
+	switch name {
+	default:
+		overrides = []override{
+			{name: "; rpc=", content: "0"},
+			{name: "; rpcuser=", content: user},
+			{name: "; rpcpass=", content: pass},
 		}
 	}
-
-	// XXX hack around extractSemVer not working properly by feeding it the
-	// filename instead of figuring it out from the URL.
-	digest, filename, err := findOS(tuple, manifestDcrdexFilename)
-	if err != nil {
-		return fmt.Errorf("Find tuple: %v", err)
-	}
-	ver, err := extractSemVer(filepath.Base(filename))
-	if err != nil {
-		return fmt.Errorf("Extract dcrdex semver from manifest "+
-			"filename %v", err)
-	}
-	manifestDcrdexVersion = ver.String()
-	log.Printf("Attempting to upgrade to Dcrdex version: %v",
-		manifestDcrdexVersion)
-
-	// Don't download bundle if it has been extracted.
-	if forceDownload || !seenBefore(filename) {
-		// Download dcrdex bundle
-		err = downloadDcrdexBundle(digest, filename)
-		if err != nil {
-			return fmt.Errorf("Download dcrdex bundle: %v", err)
-		}
-
-		err = extractDcrdexBundle()
-		if err != nil {
-			return fmt.Errorf("Extract dcrdex bundle: %v", err)
-		}
-	} else {
-		log.Printf("Using cached archive: %v", filename)
-	}
-
-	err = preconditionsDcrdexInstall()
-	if err != nil {
-		return fmt.Errorf("Pre dcrdex install: %v", err)
-	}
-
-	return nil
+	netOverrides, _ := networkOverrides(name, network)
+	overrides = append(overrides, netOverrides...)
+	return withUserOverrides(name, overrides)
 }
 
 func installDcrdexBundleConfig() error {
@@ -278,20 +214,10 @@ func installDcrdexBundleConfig() error {
 			continue
 		}
 
-		var overrides []override
-		switch dexf[k].Name {
-		default:
-			overrides = []override{
-				{name: "; rpc=", content: "0"},
-				{name: "; rpcuser=", content: username},
-				{name: "; rpcpass=", content: password},
-			}
-		}
-		// XXX add testnet and simnet support
-
 		// Install config file
+		warnUnsupportedNetwork(dexf[k].Name)
 		conf, err := createConfigFromMemory(dexf[k].SampleMemory,
-			overrides)
+			dcrdexConfigOverrides(dexf[k].Name))
 		if err != nil {
 			return err
 		}
@@ -321,34 +247,9 @@ func installDcrdexBundle() error {
 	}
 
 	// Install binaries
-	for k := range dexf {
-		src := filepath.Join(destination,
-			"bisonwallet-"+tuple+"-"+manifestDcrdexVersion, dexf[k].Name)
-		dst := filepath.Join(destination, dexf[k].Name)
-		// yep, this is ferrealz
-		if !dexf[k].Directory && strings.HasPrefix(tuple, "windows") {
-			src += ".exe"
-			dst += ".exe"
-		}
-
-		//log.Printf("Installing %v -> %v\n", src, dst)
-		if !fileExists(src) {
-			return fmt.Errorf("file not found: %v", src)
-		}
-		if fileExists(dst) {
-			err := os.RemoveAll(dst)
-			if err != nil {
-				return fmt.Errorf("Can't remove installed "+
-					"file: %v", err)
-			}
-		}
-		log.Printf("Installing: %v", dst)
-		err := copyFile(dst, src)
-		if err != nil {
-			return err
-		}
-
-		os.Chmod(dst, 0755) // Best effort is fine
+	err = installBinaries(dcrdexBundle, dcrdexBundle.Version)
+	if err != nil {
+		return err
 	}
 
 	postProcess = append(postProcess, "\nDCRDEX:\n\n"+
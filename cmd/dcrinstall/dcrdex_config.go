@@ -9,10 +9,14 @@ const (
 ; rpc=
 ; rpcuser=
 ; rpcpass=
+; testnet=
+; simnet=
 `
 
 	dexcctlSampleConfig = `
 ; rpcuser=
 ; rpcpass=
+; testnet=
+; simnet=
 `
 )
@@ -90,7 +90,7 @@ var (
 func generateClientCerts() error {
 	// Create certificate for politeiavoter
 	gencertsExe := filepath.Join(destination,
-		"decred-"+tuple+"-"+manifestDecredVersion, "gencerts")
+		decredBundle.bundleDir(decredBundle.Version), "gencerts")
 	piDir := dcrutil.AppDataDir("politeiavoter", false)
 	piClientCert := filepath.Join(piDir, clientPem)
 	piClientKey := filepath.Join(piDir, clientKey)
@@ -120,17 +120,11 @@ func generateClientCerts() error {
 // createWallet creates a wallet.
 func createWallet(net string) error {
 	// create wallet
-	log.Printf("Creating lightning wallet: %v", net)
+	log.Printf("Creating wallet: %v", net)
 
 	dcrwalletExe := filepath.Join(destination,
-		"decred-"+tuple+"-"+manifestDecredVersion, "dcrwallet")
-	args := []string{"--create"}
-	switch net {
-	case "testnet":
-		args = append(args, "--testnet")
-	case "simnet":
-		args = append(args, "--simnet")
-	}
+		decredBundle.bundleDir(decredBundle.Version), "dcrwallet")
+	args := append([]string{"--create"}, networkArgs(net)...)
 	cmd := exec.Command(dcrwalletExe, args...)
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
@@ -144,14 +138,8 @@ func lnCreateWallet(net string) error {
 	log.Printf("Creating lightning wallet: %v", net)
 
 	dcrwalletExe := filepath.Join(destination,
-		"decred-"+tuple+"-"+manifestDecredVersion, "dcrlncli")
-	args := []string{"create"}
-	switch net {
-	case "testnet":
-		args = append(args, "--testnet")
-	case "simnet":
-		args = append(args, "--simnet")
-	}
+		decredBundle.bundleDir(decredBundle.Version), "dcrlncli")
+	args := append([]string{"create"}, networkArgs(net)...)
 	cmd := exec.Command(dcrwalletExe, args...)
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
@@ -159,42 +147,38 @@ func lnCreateWallet(net string) error {
 	return cmd.Run()
 }
 
-// walletDBExists return true if the decred wallet is already created.
-func walletDBExists(net string) bool {
+// walletDBPath returns the path of the decred wallet database.
+func walletDBPath(net string) string {
 	dir := dcrutil.AppDataDir("dcrwallet", false)
-	return exists(filepath.Join(dir, net, walletDB))
+	return filepath.Join(dir, networkDir(net), walletDB)
 }
 
-// lnWalletDB return true if the decred lightning wallet is already created.
-func lnWalletDBExists(net string) bool {
+// lnWalletDBPath returns the path of the decred lightning wallet database.
+func lnWalletDBPath(net string) string {
 	dir := dcrutil.AppDataDir("dcrlnd", false)
-	return exists(filepath.Join(dir, "data", "graph", net, lnWalletDB))
+	return filepath.Join(dir, "data", "graph", networkDir(net), lnWalletDB)
 }
 
-// extractDecredBundle extracts the decred bundle into the destination
-// directory.
-func extractDecredBundle() error {
-	return extract(decredBundleFilename, destination)
+// walletDBExists return true if the decred wallet is already created.
+func walletDBExists(net string) bool {
+	return exists(walletDBPath(net))
 }
 
-// downloadDecredBundle downloads the decred bundle into the temporary
-// directory. It also verifies the that the digest of the downloaded file
-// matches the value in the manifest.
-func downloadDecredBundle(digest, filename string) error {
-	// Download bundle
-	decredBundleFilename = filepath.Join(tmpDir, filename)
-	err := DownloadFile(decredDownloadURI+filename, decredBundleFilename)
-	if err != nil {
-		return fmt.Errorf("Download decred bundle: %v", err)
-	}
+// lnWalletDB return true if the decred lightning wallet is already created.
+func lnWalletDBExists(net string) bool {
+	return exists(lnWalletDBPath(net))
+}
 
-	// Verify digest
-	err = sha256Verify(decredBundleFilename, digest)
-	if err != nil {
-		return fmt.Errorf("SHA256 verification failed: %v", err)
+// clientCertPaths returns the paths of the wallet client certificate and the
+// politeiavoter client certificate and key.
+func clientCertPaths() []string {
+	walletDir := dcrutil.AppDataDir("dcrwallet", false)
+	piDir := dcrutil.AppDataDir("politeiavoter", false)
+	return []string{
+		filepath.Join(walletDir, walletClientsPem),
+		filepath.Join(piDir, clientPem),
+		filepath.Join(piDir, clientKey),
 	}
-
-	return nil
 }
 
 // preconditionsDecredInstall determines if the tool is capable of installing
@@ -202,7 +186,11 @@ func downloadDecredBundle(digest, filename string) error {
 //   - no decred daemons are running
 //   - all the installed files have the same version
 //   - either all or none of the config files exist
-func preconditionsDecredInstall() error {
+//
+// A rollback only replaces binaries so it installs every binary at the
+// rollback version regardless of their versions and doesn't check the config
+// files.
+func preconditionsDecredInstall(b *bundleInfo, mode preconditionMode) error {
 	if runtimeTuple() != tuple {
 		log.Printf("Decred bundle installation on foreign OS, " +
 			"skipping runtime checks")
@@ -265,12 +253,28 @@ func preconditionsDecredInstall() error {
 	}
 
 	// Determine if everything or nothing is installed
-	if currentlyInstalled != 0 && currentlyInstalled != expectedInstalled {
-		return fmt.Errorf("dcrinstall requires all or none of the "+
-			"binary files to be installed. This is "+
-			"to prevent improper installations or upgrades. This "+
-			"upgrade/install requires human intervention.\n\n%v",
-			printConfigError(installedBins, notInstalledBins))
+	if currentlyInstalled != 0 && currentlyInstalled != expectedInstalled &&
+		mode != modeRollback {
+
+		if !repair {
+			return fmt.Errorf("dcrinstall requires all or none of "+
+				"the binary files to be installed. This is "+
+				"to prevent improper installations or upgrades. "+
+				"This upgrade/install requires human "+
+				"intervention or --repair to install the missing "+
+				"binaries.\n\n%v",
+				printConfigError(installedBins, notInstalledBins))
+		}
+		b.repairBinaries(installedBins, notInstalledBins)
+	}
+
+	// Determine if all binaries have the same version
+	err := b.checkMixedVersions(currentVersion, mode)
+	if err != nil {
+		return err
+	}
+	if mode == modeRollback {
+		return nil
 	}
 
 	// Install config files if applicable
@@ -299,11 +303,18 @@ func preconditionsDecredInstall() error {
 	}
 
 	if currentConfigFiles != 0 && currentConfigFiles != expectedConfigFiles {
-		return fmt.Errorf("dcrinstall requires all or none of the "+
-			"configuration files to be installed. This is "+
-			"to prevent improper installations or upgrades. This "+
-			"upgrade/install requires human intervention.\n\n%v",
-			printConfigError(installedConfigs, notInstalledConfigs))
+		if !repair {
+			return fmt.Errorf("dcrinstall requires all or none of "+
+				"the configuration files to be installed. This "+
+				"is to prevent improper installations or "+
+				"upgrades. This upgrade/install requires human "+
+				"intervention or --repair to generate the "+
+				"missing configuration files.\n\n%v",
+				printConfigError(installedConfigs,
+					notInstalledConfigs))
+		}
+		b.repairConfigs(installedConfigs, notInstalledConfigs,
+			bundleCredentials(installedConfigs))
 	}
 
 	// We can now create config files in their respective directories and
@@ -312,88 +323,31 @@ func preconditionsDecredInstall() error {
 	return nil
 }
 
-// decredDownloadAndVerify downloads, verifies and asserts that the decred
-// bundle can be safely upgraded. This function asserts that all preconditions
-// are met before being able to proceed with the decred bundle install.
-func decredDownloadAndVerify() error {
-	// Download the decred manifest
-	manifestDecredFilename = filepath.Join(tmpDir,
-		filepath.Base(decredManifestURI))
-
-	err := DownloadFile(decredManifestURI, manifestDecredFilename)
-	if err != nil {
-		return fmt.Errorf("Download manifest file: %v", err)
-	}
-	if decredManifestDigest != "" {
-		// Optional digest was set so check it
-		err = sha256Verify(manifestDecredFilename, decredManifestDigest)
-		if err != nil {
-			return fmt.Errorf("SHA256 of decred manifest "+
-				"verification failed: %v", err)
-		}
-	}
-	decredDownloadURI, err = getDownloadURI(decredManifestURI)
-	if err != nil {
-		return fmt.Errorf("Get download URI: %v", err)
-	}
-
-	if !skipPGP {
-		// Download the decred manifest signature
-		manifestDecredSignatureFilename = filepath.Join(tmpDir,
-			filepath.Base(decredManifestURI)+".asc")
-		err = DownloadFile(decredManifestURI+".asc",
-			manifestDecredSignatureFilename)
-		if err != nil {
-			return fmt.Errorf("Download manifest signature file: "+
-				"%v", err)
-		}
-
-		// Verify decred manifest signature
-		err = pgpVerify(manifestDecredSignatureFilename,
-			manifestDecredFilename, dcrinstallPubkey)
-		if err != nil {
-			return fmt.Errorf("manifest PGP signature incorrect: "+
-				"%v", err)
+// decredConfigOverrides returns the overrides that are applied to the sample
+// config file of the provided decred binary.
+func decredConfigOverrides(name string) []override {
+	user, pass := decredBundle.rpcCredentials()
+	var overrides []override
+	switch name {
+	case "dcrwallet":
+		overrides = []override{
+			{name: "; username=", content: user},
+			{name: "; password=", content: pass},
 		}
-	}
-
-	// XXX hack around extractSemVer not working properly by feeding it the
-	// filename instead of figuring it out from the URL.
-	digest, filename, err := findOS(tuple, manifestDecredFilename)
-	if err != nil {
-		return fmt.Errorf("Find tuple: %v", err)
-	}
-	ver, err := extractSemVer(filepath.Base(filename))
-	if err != nil {
-		return fmt.Errorf("Extract decred semver from manifest "+
-			"filename %v", err)
-	}
-	manifestDecredVersion = ver.String()
-	log.Printf("Attempting to upgrade to Decred version: %v",
-		manifestDecredVersion)
-
-	// Don't download bundle if it has been extracted.
-	if forceDownload || !seenBefore(filename) {
-		// Download decred bundle
-		err = downloadDecredBundle(digest, filename)
-		if err != nil {
-			return fmt.Errorf("Download decred bundle: %v", err)
+	case "dcrlnd":
+		overrides = []override{
+			{name: "; dcrd.rpcuser=", content: user},
+			{name: "; dcrd.rpcpass=", content: pass},
 		}
-
-		err = extractDecredBundle()
-		if err != nil {
-			return fmt.Errorf("Extract decred bundle: %v", err)
+	default:
+		overrides = []override{
+			{name: "; rpcuser=", content: user},
+			{name: "; rpcpass=", content: pass},
 		}
-	} else {
-		log.Printf("Using cached archive: %v", filename)
 	}
-
-	err = preconditionsDecredInstall()
-	if err != nil {
-		return fmt.Errorf("Pre decred install: %v", err)
-	}
-
-	return nil
+	netOverrides, _ := networkOverrides(name, network)
+	overrides = append(overrides, netOverrides...)
+	return withUserOverrides(name, overrides)
 }
 
 func installDecredBundleConfig() error {
@@ -404,45 +358,33 @@ func installDecredBundleConfig() error {
 	}
 
 	// Install config files
+	previous := decredBundle.activeVersion()
 	for k := range df {
 		if df[k].Config == "" {
 			continue
 		}
 
-		// Check if the config file is already installed.
+		// Check if the config file is already installed and report
+		// how its sample changed since the previous version.
 		ext := filepath.Ext(df[k].Config)
 		name := strings.TrimSuffix(df[k].Config, ext)
 		dir := dcrutil.AppDataDir(name, false)
 		dst := filepath.Join(dir, df[k].Config)
 		if exists(dst) {
-			continue
-		}
-
-		var overrides []override
-		switch df[k].Name {
-		case "dcrwallet":
-			overrides = []override{
-				{name: "; username=", content: username},
-				{name: "; password=", content: password},
-			}
-		case "dcrlnd":
-			overrides = []override{
-				{name: "; dcrd.rpcuser=", content: username},
-				{name: "; dcrd.rpcpass=", content: password},
-			}
-		default:
-			overrides = []override{
-				{name: "; rpcuser=", content: username},
-				{name: "; rpcpass=", content: password},
+			err := migrateConfig(decredBundle, df[k], previous)
+			if err != nil {
+				return fmt.Errorf("Migrate %v: %v", dst, err)
 			}
+			continue
 		}
-		// XXX add testnet and simnet support
 
 		// Install config file
+		warnUnsupportedNetwork(df[k].Name)
 		src := filepath.Join(destination,
-			"decred-"+tuple+"-"+manifestDecredVersion,
+			decredBundle.bundleDir(decredBundle.Version),
 			df[k].SampleFilename)
-		conf, err := createConfigFromFile(src, overrides)
+		conf, err := createConfigFromFile(src,
+			decredConfigOverrides(df[k].Name))
 		if err != nil {
 			return err
 		}
@@ -479,9 +421,13 @@ func installDecredBundleConfig() error {
 	}
 
 	// Check if wallet exists.
-	if walletDBExists(network) {
+	switch {
+	case !supportsNetwork("dcrwallet", network):
+		log.Printf("dcrwallet does not support %v, skipping wallet "+
+			"creation.", network)
+	case walletDBExists(network):
 		log.Printf("Wallet exists, skipping creation.")
-	} else {
+	default:
 		err := createWallet(network)
 		if err != nil {
 			return fmt.Errorf("Can't create wallet: %v", err)
@@ -522,34 +468,9 @@ func installDecredBundle() error {
 	}
 
 	// Install binaries
-	for k := range df {
-		src := filepath.Join(destination,
-			"decred-"+tuple+"-"+manifestDecredVersion, df[k].Name)
-		dst := filepath.Join(destination, df[k].Name)
-		// yep, this is ferrealz
-		if !df[k].Directory && strings.HasPrefix(tuple, "windows") {
-			src += ".exe"
-			dst += ".exe"
-		}
-
-		//log.Printf("Installing %v -> %v\n", src, dst)
-		if !fileExists(src) {
-			return fmt.Errorf("file not found: %v", src)
-		}
-		if fileExists(dst) {
-			err := os.RemoveAll(dst)
-			if err != nil {
-				return fmt.Errorf("Can't remove installed "+
-					"file: %v", err)
-			}
-		}
-		log.Printf("Installing: %v", dst)
-		err := copyFile(dst, src)
-		if err != nil {
-			return err
-		}
-
-		os.Chmod(dst, 0755) // Best effort is fine
+	err = installBinaries(decredBundle, decredBundle.Version)
+	if err != nil {
+		return err
 	}
 
 	return nil
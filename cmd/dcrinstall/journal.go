@@ -0,0 +1,297 @@
+// Copyright (c) 2022 The Decred developers
+// Use of this source code is governed by an ISC license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// journalFilename is the name of the installation journal that lives
+	// in the destination directory while binaries are being swapped in.
+	journalFilename = "dcrinstall.journal"
+
+	stagedSuffix = ".dcrinstall-new" // New binary staged next to the destination
+	backupSuffix = ".dcrinstall-old" // Previous binary moved out of the way
+)
+
+// journalEntry describes the replacement of a single installed file.
+type journalEntry struct {
+	Destination string `json:"destination"` // Installed filename
+	Staged      string `json:"staged"`      // Staged new file
+	Backup      string `json:"backup"`      // Backup of the previous file
+	Existed     bool   `json:"existed"`     // Destination existed before install
+}
+
+// journal records all file replacements of a bundle installation. It is
+// written to disk before any installed file is touched so that an
+// interrupted installation can be rolled back.
+type journal struct {
+	Bundle  string         `json:"bundle"`
+	Entries []journalEntry `json:"entries"`
+}
+
+// journalPath returns the path of the installation journal.
+func journalPath() string {
+	return filepath.Join(destination, journalFilename)
+}
+
+// writeJournal atomically writes the journal to the destination directory.
+func writeJournal(j *journal) error {
+	b, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	filename := journalPath()
+	f, err := os.OpenFile(filename+".tmp",
+		os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	err = f.Sync()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	// Close file because windows
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(filename+".tmp", filename)
+}
+
+// readJournal reads the journal from the destination directory.
+func readJournal() (*journal, error) {
+	b, err := os.ReadFile(journalPath())
+	if err != nil {
+		return nil, err
+	}
+	var j journal
+	err = json.Unmarshal(b, &j)
+	if err != nil {
+		return nil, fmt.Errorf("invalid journal %v: %w", journalPath(),
+			err)
+	}
+	return &j, nil
+}
+
+// removeJournal removes the journal which marks the installation as
+// committed.
+func removeJournal() error {
+	err := os.Remove(journalPath())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// rollback restores all files recorded in the journal to their state prior
+// to installation. It is safe to call at any point of the swap, including
+// after a crash, and may be called repeatedly.
+func (j *journal) rollback() error {
+	log.Printf("Rolling back installation: %v", j.Bundle)
+
+	var failed []string
+	for _, e := range j.Entries {
+		switch {
+		case exists(e.Backup):
+			// Previous file was moved out of the way, put it back.
+			if exists(e.Destination) {
+				err := os.Remove(e.Destination)
+				if err != nil {
+					log.Printf("Rollback remove %v: %v",
+						e.Destination, err)
+					failed = append(failed, e.Destination)
+					continue
+				}
+			}
+			log.Printf("Restoring: %v", e.Destination)
+			err := os.Rename(e.Backup, e.Destination)
+			if err != nil {
+				log.Printf("Rollback restore %v: %v",
+					e.Destination, err)
+				failed = append(failed, e.Destination)
+				continue
+			}
+
+		case !e.Existed && exists(e.Destination):
+			// File is new, remove it.
+			log.Printf("Removing: %v", e.Destination)
+			err := os.Remove(e.Destination)
+			if err != nil {
+				log.Printf("Rollback remove %v: %v",
+					e.Destination, err)
+				failed = append(failed, e.Destination)
+				continue
+			}
+		}
+
+		// Previous file is in place, drop staged file if any.
+		if exists(e.Staged) {
+			os.Remove(e.Staged) // Best effort is fine
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("rollback failed, journal %v retained: %v",
+			journalPath(), failed)
+	}
+
+	return removeJournal()
+}
+
+// recoverJournal rolls back an interrupted installation if a journal exists
+// in the destination directory.
+func recoverJournal() error {
+	if !exists(journalPath()) {
+		return nil
+	}
+
+	log.Printf("Interrupted installation detected: %v", journalPath())
+	j, err := readJournal()
+	if err != nil {
+		return err
+	}
+	err = j.rollback()
+	if err != nil {
+		return err
+	}
+	log.Printf("Interrupted installation rolled back: %v", j.Bundle)
+
+	return nil
+}
+
+// installBinaries installs the binaries of the provided version of the bundle
+// from its extracted directory into the destination and records the version
+// as the active one. All binaries and the active record are first staged next
+// to their destination and then swapped in by renaming them. The swap is
+// recorded in a journal so that a failure either here or in a prior run
+// restores the previously installed binaries and active record. Configuration
+// files are written before and are not covered by the journal.
+func installBinaries(b *bundleInfo, version string) error {
+	bundle := b.bundleDir(version)
+	files := b.Files
+	j := &journal{Bundle: bundle}
+
+	// Stage binaries
+	for k := range files {
+		src := filepath.Join(destination, bundle, files[k].Name)
+		dst := filepath.Join(destination, files[k].Name)
+		// yep, this is ferrealz
+		if !files[k].Directory && strings.HasPrefix(tuple, "windows") {
+			src += ".exe"
+			dst += ".exe"
+		}
+
+		e := journalEntry{
+			Destination: dst,
+			Staged:      dst + stagedSuffix,
+			Backup:      dst + backupSuffix,
+			Existed:     fileExists(dst),
+		}
+		j.Entries = append(j.Entries, e)
+
+		if !fileExists(src) {
+			removeStaged(j)
+			return fmt.Errorf("file not found: %v", src)
+		}
+		log.Printf("Staging: %v", e.Staged)
+		// Remove leftovers of prior runs so that a rollback never
+		// restores a stale backup.
+		err := os.RemoveAll(e.Backup)
+		if err == nil {
+			err = os.RemoveAll(e.Staged)
+		}
+		if err == nil {
+			err = copyFile(e.Staged, src)
+		}
+		if err != nil {
+			removeStaged(j)
+			return fmt.Errorf("Can't stage file: %v", err)
+		}
+
+		os.Chmod(e.Staged, 0755) // Best effort is fine
+	}
+
+	// Stage the active record so that it is swapped in with the
+	// binaries.
+	active := filepath.Join(destination, activeFilename)
+	e := journalEntry{
+		Destination: active,
+		Staged:      active + stagedSuffix,
+		Backup:      active + backupSuffix,
+		Existed:     fileExists(active),
+	}
+	j.Entries = append(j.Entries, e)
+	err := os.RemoveAll(e.Backup)
+	if err == nil {
+		err = writeActive(e.Staged, b.Name, version)
+	}
+	if err != nil {
+		removeStaged(j)
+		return fmt.Errorf("Can't stage active versions: %v", err)
+	}
+
+	// Record what is about to happen before touching installed files.
+	err = writeJournal(j)
+	if err != nil {
+		removeStaged(j)
+		return fmt.Errorf("Can't write journal: %v", err)
+	}
+
+	// Swap binaries
+	for _, e := range j.Entries {
+		if e.Existed {
+			err = os.Rename(e.Destination, e.Backup)
+			if err != nil {
+				err = fmt.Errorf("Can't move installed file: %v", err)
+				break
+			}
+		}
+		log.Printf("Installing: %v", e.Destination)
+		err = os.Rename(e.Staged, e.Destination)
+		if err != nil {
+			err = fmt.Errorf("Can't install file: %v", err)
+			break
+		}
+	}
+	if err != nil {
+		rerr := j.rollback()
+		if rerr != nil {
+			return fmt.Errorf("%v; %v", err, rerr)
+		}
+		return err
+	}
+
+	// Commit, from here on the new binaries are considered installed.
+	err = removeJournal()
+	if err != nil {
+		return fmt.Errorf("Can't remove journal: %v", err)
+	}
+	for _, e := range j.Entries {
+		os.RemoveAll(e.Backup) // Best effort is fine
+	}
+
+	return nil
+}
+
+// removeStaged removes all files that were staged for the provided journal.
+func removeStaged(j *journal) {
+	for _, e := range j.Entries {
+		os.RemoveAll(e.Staged) // Best effort is fine
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright (c) 2022 The Decred developers
+// Use of this source code is governed by an ISC license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// setupJournalTest points the destination at a temporary directory and
+// returns a bundle with two binaries whose provided versions are extracted
+// into it.
+func setupJournalTest(t *testing.T, versions ...string) *bundleInfo {
+	t.Helper()
+
+	oldDestination, oldTuple := destination, tuple
+	t.Cleanup(func() {
+		destination, tuple = oldDestination, oldTuple
+	})
+	destination = t.TempDir()
+	tuple = "linux-amd64"
+
+	b := &bundleInfo{
+		Name:   "decred",
+		Prefix: "decred",
+		Files:  []decredFiles{{Name: "dcrd"}, {Name: "dcrctl"}},
+	}
+	for _, v := range versions {
+		dir := filepath.Join(destination, b.bundleDir(v))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range b.Files {
+			writeTestFile(t, filepath.Join(dir, f.Name), f.Name+" "+v)
+		}
+	}
+	return b
+}
+
+// writeTestFile writes content to filename.
+func writeTestFile(t *testing.T, filename, content string) {
+	t.Helper()
+
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// assertInstalled asserts that every binary of the bundle and the active
+// record are at the provided version and that nothing of the swap is left.
+func assertInstalled(t *testing.T, b *bundleInfo, version string) {
+	t.Helper()
+
+	for _, f := range b.Files {
+		filename := filepath.Join(destination, f.Name)
+		content, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != f.Name+" "+version {
+			t.Errorf("%v: got %q, want %v %v", f.Name, content,
+				f.Name, version)
+		}
+		for _, suffix := range []string{stagedSuffix, backupSuffix} {
+			if exists(filename + suffix) {
+				t.Errorf("left over: %v", filename+suffix)
+			}
+		}
+	}
+	active, err := readActive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if active[b.Name] != version {
+		t.Errorf("active: got %q, want %v", active[b.Name], version)
+	}
+	if exists(journalPath()) {
+		t.Errorf("journal left over: %v", journalPath())
+	}
+}
+
+// TestInstallBinaries ensures binaries and the active record are installed
+// and upgraded together and that a failed staging leaves everything alone.
+func TestInstallBinaries(t *testing.T) {
+	b := setupJournalTest(t, "v2.0.0", "v2.1.0")
+
+	if err := installBinaries(b, "v2.0.0"); err != nil {
+		t.Fatal(err)
+	}
+	assertInstalled(t, b, "v2.0.0")
+
+	if err := installBinaries(b, "v2.1.0"); err != nil {
+		t.Fatal(err)
+	}
+	assertInstalled(t, b, "v2.1.0")
+
+	// A version that isn't extracted completely fails before anything is
+	// swapped.
+	err := os.MkdirAll(filepath.Join(destination, b.bundleDir("v2.2.0")),
+		0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(destination, b.bundleDir("v2.2.0"),
+		"dcrd"), "dcrd v2.2.0")
+	if err := installBinaries(b, "v2.2.0"); err == nil {
+		t.Fatal("expected error")
+	}
+	assertInstalled(t, b, "v2.1.0")
+}
+
+// TestJournalRollback ensures an interrupted swap, either in this run or left
+// over from a crashed run, restores the previous binaries and active record.
+func TestJournalRollback(t *testing.T) {
+	tests := []struct {
+		name    string
+		swapped int // Entries that were swapped before the failure
+	}{
+		{"nothing swapped", 0},
+		{"first swapped", 1},
+		{"binaries swapped", 2},
+		{"all swapped", 3},
+	}
+	for _, test := range tests {
+		b := setupJournalTest(t, "v2.0.0", "v2.1.0")
+		if err := installBinaries(b, "v2.0.0"); err != nil {
+			t.Fatal(err)
+		}
+
+		// Build the state of a swap to v2.1.0 that was interrupted
+		// after the provided number of entries.
+		j := &journal{Bundle: b.bundleDir("v2.1.0")}
+		names := []string{"dcrd", "dcrctl", activeFilename}
+		for k, name := range names {
+			dst := filepath.Join(destination, name)
+			e := journalEntry{
+				Destination: dst,
+				Staged:      dst + stagedSuffix,
+				Backup:      dst + backupSuffix,
+				Existed:     true,
+			}
+			j.Entries = append(j.Entries, e)
+
+			content := name + " v2.1.0"
+			if name == activeFilename {
+				content = `{"decred": "v2.1.0"}`
+			}
+			if k >= test.swapped {
+				writeTestFile(t, e.Staged, content)
+				continue
+			}
+			if err := os.Rename(dst, e.Backup); err != nil {
+				t.Fatal(err)
+			}
+			writeTestFile(t, dst, content)
+		}
+		if err := writeJournal(j); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := recoverJournal(); err != nil {
+			t.Fatalf("%v: %v", test.name, err)
+		}
+		assertInstalled(t, b, "v2.0.0")
+	}
+}
+
+// TestJournalRollbackNew ensures a rollback removes files that didn't exist
+// before the installation.
+func TestJournalRollbackNew(t *testing.T) {
+	b := setupJournalTest(t, "v2.0.0")
+
+	dst := filepath.Join(destination, "dcrd")
+	j := &journal{
+		Bundle: b.bundleDir("v2.0.0"),
+		Entries: []journalEntry{{
+			Destination: dst,
+			Staged:      dst + stagedSuffix,
+			Backup:      dst + backupSuffix,
+		}},
+	}
+	writeTestFile(t, dst, "dcrd v2.0.0")
+	if err := writeJournal(j); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := recoverJournal(); err != nil {
+		t.Fatal(err)
+	}
+	if exists(dst) {
+		t.Errorf("new file not removed: %v", dst)
+	}
+	if exists(journalPath()) {
+		t.Errorf("journal left over: %v", journalPath())
+	}
+
+	// Nothing to recover without a journal.
+	if err := recoverJournal(); err != nil {
+		t.Fatal(err)
+	}
+}
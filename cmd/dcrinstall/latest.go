@@ -0,0 +1,192 @@
+// Copyright (c) 2022 The Decred developers
+// Use of this source code is governed by an ISC license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"golang.org/x/crypto/openpgp/clearsign"
+)
+
+// dcrinstallComponent is the component of the dcrinstall manifest in the
+// latest manifest. The other components are the bundle prefixes.
+const dcrinstallComponent = "dcrinstall"
+
+// manifestNameRE matches the name of a manifest listed in the latest manifest
+// and captures its component and semantic version.
+var manifestNameRE = regexp.MustCompile(`^([a-z][a-z0-9]*)-(v(0|[1-9]\d*)\.` +
+	`(0|[1-9]\d*)\.(0|[1-9]\d*)(-[0-9A-Za-z-]+(\.[0-9A-Za-z-]+)*)?` +
+	`(\+[0-9A-Za-z-]+(\.[0-9A-Za-z-]+)*)?)-manifest\.txt$`)
+
+// latestEntry is a manifest listed in the latest manifest.
+type latestEntry struct {
+	Component string // Bundle prefix or dcrinstall
+	Version   string // Semantic version, e.g. v2.10.0
+	Digest    string // SHA256 digest of the manifest
+	URI       string // Location of the manifest
+	Line      int    // Line in the latest manifest
+}
+
+// latestManifest is a parsed latest manifest.
+type latestManifest struct {
+	Entries  []latestEntry // Known manifests in order of appearance
+	Mirrors  []string      // Mirror base URLs
+	Warnings []string      // Ignored lines
+}
+
+// entry returns the entry of the provided component or nil if the latest
+// manifest does not list it.
+func (m *latestManifest) entry(component string) *latestEntry {
+	for k := range m.Entries {
+		if m.Entries[k].Component == component {
+			return &m.Entries[k]
+		}
+	}
+	return nil
+}
+
+// warn logs the lines of the latest manifest that were ignored.
+func (m *latestManifest) warn() {
+	for _, w := range m.Warnings {
+		log.Printf("Latest manifest: %v", w)
+	}
+}
+
+// latestComponents returns the components that dcrinstall knows about.
+func latestComponents() map[string]bool {
+	components := map[string]bool{dcrinstallComponent: true}
+	for _, b := range bundles {
+		components[b.Prefix] = true
+	}
+	return components
+}
+
+// parseLatest parses the content of a latest manifest. It consists of
+// "<sha256> <uri>" lines that list the manifests of a release and
+// "mirror <url>" lines that list mirrors. Malformed entries are an error,
+// unknown and duplicate entries are ignored with a warning.
+// Line numbers are offset by the provided number of lines that precede data
+// in the latest manifest file.
+func parseLatest(data []byte, offset int) (*latestManifest, error) {
+	components := latestComponents()
+	var m latestManifest
+	warn := func(line int, format string, args ...interface{}) {
+		m.Warnings = append(m.Warnings, fmt.Sprintf("line %v: ", line)+
+			fmt.Sprintf(format, args...))
+	}
+	for i, line := range strings.Split(string(data), "\n") {
+		n := offset + i + 1
+		a := strings.Fields(line)
+		switch {
+		case len(a) == 0:
+			continue
+		case len(a) == 2 && a[0] == "mirror":
+			mirror, err := normalizeMirror(a[1])
+			if err != nil {
+				warn(n, "ignoring mirror: %v", err)
+				continue
+			}
+			m.Mirrors = append(m.Mirrors, mirror)
+			continue
+		case len(a) != 2:
+			warn(n, "ignoring unknown line: %v",
+				strings.TrimSpace(line))
+			continue
+		}
+
+		digest, uri := a[0], a[1]
+		name := path.Base(uri)
+		matches := manifestNameRE.FindStringSubmatch(name)
+		if matches == nil {
+			warn(n, "ignoring unknown entry: %v", uri)
+			continue
+		}
+		if b, err := hex.DecodeString(digest); err != nil ||
+			len(b) != 32 {
+
+			return nil, fmt.Errorf("invalid digest on line %v: %v",
+				n, digest)
+		}
+		if !components[matches[1]] {
+			warn(n, "ignoring unknown component %v: %v",
+				matches[1], uri)
+			continue
+		}
+		if e := m.entry(matches[1]); e != nil {
+			warn(n, "ignoring duplicate %v entry, using line %v: %v",
+				matches[1], e.Line, uri)
+			continue
+		}
+
+		m.Entries = append(m.Entries, latestEntry{
+			Component: matches[1],
+			Version:   matches[2],
+			Digest:    strings.ToLower(digest),
+			URI:       uri,
+			Line:      n,
+		})
+	}
+
+	return &m, nil
+}
+
+// latestContent returns the content of the latest manifest that entries are
+// read from and the number of lines that precede it in the file. Only the
+// plaintext of a clear signed latest manifest is covered by its signature so
+// nothing around it is ever used. A latest manifest that is not signed, such
+// as one rewritten by 'dcrinstall mirror', is used as is.
+func latestContent(filename string) ([]byte, int, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, 0, err
+	}
+	if b, _ := clearsign.Decode(data); b == nil {
+		return data, 0, nil
+	}
+	b, err := decodeClearSigned(data)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%v: %v", filename, err)
+	}
+	return b.Plaintext, signedBodyOffset(data), nil
+}
+
+// signedBodyOffset returns the number of lines that precede the signed body
+// of the clear signed message in data, which are the lines up to and
+// including the blank line that ends the armor headers.
+func signedBodyOffset(data []byte) int {
+	start := bytes.Index(data, []byte("-----BEGIN PGP SIGNED MESSAGE-----"))
+	if start < 0 {
+		return 0
+	}
+	offset := bytes.Count(data[:start], []byte("\n"))
+	for _, line := range strings.Split(string(data[start:]), "\n") {
+		offset++
+		if strings.TrimSpace(line) == "" {
+			break
+		}
+	}
+	return offset
+}
+
+// readLatest reads and parses the provided latest manifest.
+func readLatest(filename string) (*latestManifest, error) {
+	data, offset, err := latestContent(filename)
+	if err != nil {
+		return nil, err
+	}
+	m, err := parseLatest(data, offset)
+	if err != nil {
+		return nil, fmt.Errorf("invalid latest manifest %v: %v",
+			filename, err)
+	}
+	return m, nil
+}
@@ -0,0 +1,158 @@
+// Copyright (c) 2022 The Decred developers
+// Use of this source code is governed by an ISC license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestParseLatest ensures latest manifests are parsed into entries and
+// mirrors and that ignored lines are reported with their line number.
+func TestParseLatest(t *testing.T) {
+	const (
+		d1 = "2a1f1cbe1e7b3ed73c9e4ab8f0b9b1c6bd16ad10b1c6ed2c5a7b1ab0" +
+			"e31a4cf0"
+		d2 = "8B1CC3E0F3A4D33C6A2BDB1F81C9E8F8A2E7DDB1EA4C6B1B4F1E7C" +
+			"2F0E1D9A3B"
+		uri = "https://github.com/decred/decred-release/releases/" +
+			"download/v2.1.0/"
+	)
+
+	tests := []struct {
+		name     string
+		data     string
+		offset   int
+		entries  []latestEntry
+		mirrors  []string
+		warnings []string
+		err      bool
+	}{{
+		name: "entries",
+		data: d1 + " " + uri + "decred-v2.1.0-manifest.txt\n" +
+			"\n" +
+			d2 + "  " + uri + "bisonwallet-v1.0.7-manifest.txt\n",
+		entries: []latestEntry{{
+			Component: "decred",
+			Version:   "v2.1.0",
+			Digest:    d1,
+			URI:       uri + "decred-v2.1.0-manifest.txt",
+			Line:      1,
+		}, {
+			Component: "bisonwallet",
+			Version:   "v1.0.7",
+			Digest:    strings.ToLower(d2),
+			URI:       uri + "bisonwallet-v1.0.7-manifest.txt",
+			Line:      3,
+		}},
+	}, {
+		name: "pre-release",
+		data: d1 + " " + uri + "dcrinstall-v2.1.0-rc1-manifest.txt\n",
+		entries: []latestEntry{{
+			Component: "dcrinstall",
+			Version:   "v2.1.0-rc1",
+			Digest:    d1,
+			URI:       uri + "dcrinstall-v2.1.0-rc1-manifest.txt",
+			Line:      1,
+		}},
+	}, {
+		name: "mirrors",
+		data: "mirror https://mirror.example.org/decred\n" +
+			"mirror ftp://mirror.example.org/\n",
+		mirrors: []string{"https://mirror.example.org/decred/"},
+		warnings: []string{"line 2: ignoring mirror: invalid mirror " +
+			"URL: ftp://mirror.example.org/"},
+	}, {
+		name:   "offset",
+		data:   "garbage\n",
+		offset: 3,
+		warnings: []string{"line 4: ignoring unknown line: " +
+			"garbage"},
+	}, {
+		name: "unknown",
+		data: "a b c\n" +
+			d1 + " " + uri + "decred-v2.1.0.tar.gz\n" +
+			d1 + " " + uri + "dcrdex-v1.0.0-manifest.txt\n",
+		warnings: []string{
+			"line 1: ignoring unknown line: a b c",
+			"line 2: ignoring unknown entry: " + uri +
+				"decred-v2.1.0.tar.gz",
+			"line 3: ignoring unknown component dcrdex: " + uri +
+				"dcrdex-v1.0.0-manifest.txt",
+		},
+	}, {
+		name: "duplicate",
+		data: d1 + " " + uri + "decred-v2.1.0-manifest.txt\n" +
+			d2 + " " + uri + "decred-v2.0.0-manifest.txt\n",
+		entries: []latestEntry{{
+			Component: "decred",
+			Version:   "v2.1.0",
+			Digest:    d1,
+			URI:       uri + "decred-v2.1.0-manifest.txt",
+			Line:      1,
+		}},
+		warnings: []string{"line 2: ignoring duplicate decred entry, " +
+			"using line 1: " + uri + "decred-v2.0.0-manifest.txt"},
+	}, {
+		name: "short digest",
+		data: "2a1f " + uri + "decred-v2.1.0-manifest.txt\n",
+		err:  true,
+	}, {
+		name: "invalid digest",
+		data: strings.Repeat("x", 64) + " " + uri +
+			"decred-v2.1.0-manifest.txt\n",
+		err: true,
+	}}
+	for _, test := range tests {
+		m, err := parseLatest([]byte(test.data), test.offset)
+		if test.err {
+			if err == nil {
+				t.Errorf("%v: expected error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(m.Entries, test.entries) {
+			t.Errorf("%v: got entries %v, want %v", test.name,
+				m.Entries, test.entries)
+		}
+		if !reflect.DeepEqual(m.Mirrors, test.mirrors) {
+			t.Errorf("%v: got mirrors %v, want %v", test.name,
+				m.Mirrors, test.mirrors)
+		}
+		if !reflect.DeepEqual(m.Warnings, test.warnings) {
+			t.Errorf("%v: got warnings %q, want %q", test.name,
+				m.Warnings, test.warnings)
+		}
+	}
+}
+
+// TestSignedBodyOffset ensures line numbers of a clear signed latest
+// manifest are offset by the lines that precede the signed body.
+func TestSignedBodyOffset(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want int
+	}{
+		{"unsigned", "a\nb\n", 0},
+		{"signed", "-----BEGIN PGP SIGNED MESSAGE-----\n" +
+			"Hash: SHA256\n\nbody\n", 3},
+		{"leading blank lines", "\n\n-----BEGIN PGP SIGNED " +
+			"MESSAGE-----\nHash: SHA256\n\nbody\n", 5},
+		{"crlf", "-----BEGIN PGP SIGNED MESSAGE-----\r\n" +
+			"Hash: SHA256\r\n\r\nbody\r\n", 3},
+	}
+	for _, test := range tests {
+		got := signedBodyOffset([]byte(test.data))
+		if got != test.want {
+			t.Errorf("%v: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,334 @@
+// Copyright (c) 2022 The Decred developers
+// Use of this source code is governed by an ISC license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// configKeyRE matches a, possibly commented out, option in a config file and
+// captures its name.
+var configKeyRE = regexp.MustCompile(`^[;#]?\s*([A-Za-z][A-Za-z0-9._-]*)\s*=`)
+
+// sampleOptions returns the options that the provided sample config
+// documents and whether they are deprecated. An option is deprecated when
+// its line or the comment block directly above it mentions it.
+func sampleOptions(sample string) map[string]bool {
+	options := make(map[string]bool)
+	var deprecated bool
+	for _, line := range strings.Split(sample, "\n") {
+		line = strings.TrimSpace(line)
+		mentioned := strings.Contains(strings.ToLower(line), "deprecated")
+		m := configKeyRE.FindStringSubmatch(line)
+		switch {
+		case line == "":
+			deprecated = false
+		case m != nil:
+			options[m[1]] = options[m[1]] || deprecated || mentioned
+		case mentioned:
+			deprecated = true
+		}
+	}
+	return options
+}
+
+// configValue is an option that is set in a config file.
+type configValue struct {
+	key     string
+	value   string
+	section string
+}
+
+// configValues returns the options that are set, i.e. not commented out, in
+// the provided config in order of appearance.
+func configValues(config string) []configValue {
+	var values []configValue
+	var section string
+	for _, line := range strings.Split(config, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = line
+			continue
+		}
+		if strings.HasPrefix(line, ";") || strings.HasPrefix(line, "#") {
+			continue
+		}
+		m := configKeyRE.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		values = append(values, configValue{
+			key:     m[1],
+			value:   strings.TrimSpace(line[len(m[0]):]),
+			section: section,
+		})
+	}
+	return values
+}
+
+// configMigration describes how the sample config of an application changed
+// between two bundle versions and what that means for the live config.
+type configMigration struct {
+	Config     string   // Live config file
+	From       string   // Previous bundle version
+	To         string   // New bundle version
+	Added      []string // Options added to the sample
+	Deprecated []string // Options set in the config that are now deprecated
+	Removed    []string // Options set in the config that were removed
+
+	oldOptions map[string]bool
+	newOptions map[string]bool
+	sample     string
+	live       string
+}
+
+// newConfigMigration compares the old and new sample configs and the options
+// that are set in the live config.
+func newConfigMigration(config, from, to, oldSample, newSample,
+	live string) *configMigration {
+
+	m := &configMigration{
+		Config:     config,
+		From:       from,
+		To:         to,
+		oldOptions: sampleOptions(oldSample),
+		newOptions: sampleOptions(newSample),
+		sample:     newSample,
+		live:       live,
+	}
+	for k := range m.newOptions {
+		if _, ok := m.oldOptions[k]; !ok {
+			m.Added = append(m.Added, k)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, v := range configValues(live) {
+		if seen[v.key] {
+			continue
+		}
+		seen[v.key] = true
+
+		deprecated, ok := m.newOptions[v.key]
+		_, wasDocumented := m.oldOptions[v.key]
+		switch {
+		case !ok && wasDocumented:
+			m.Removed = append(m.Removed, v.key)
+		case deprecated:
+			m.Deprecated = append(m.Deprecated, v.key)
+		}
+	}
+	sort.Strings(m.Added)
+	sort.Strings(m.Deprecated)
+	sort.Strings(m.Removed)
+
+	return m
+}
+
+// changed returns true if the migration has anything to report.
+func (m *configMigration) changed() bool {
+	return len(m.Added) != 0 || len(m.Deprecated) != 0 ||
+		len(m.Removed) != 0
+}
+
+// report returns a human readable description of the migration.
+func (m *configMigration) report() string {
+	rv := fmt.Sprintf("Configuration changes from %v to %v for %v:\n",
+		m.From, m.To, m.Config)
+	if len(m.Added) != 0 {
+		rv += fmt.Sprintf("\tNew options: %v\n",
+			strings.Join(m.Added, ", "))
+	}
+	if len(m.Deprecated) != 0 {
+		rv += fmt.Sprintf("\tDeprecated options that are set: %v\n",
+			strings.Join(m.Deprecated, ", "))
+	}
+	if len(m.Removed) != 0 {
+		rv += fmt.Sprintf("\tRemoved options that are set: %v\n",
+			strings.Join(m.Removed, ", "))
+	}
+	return rv
+}
+
+// merge returns the new sample config with every option that is set in the
+// live config. Set options replace their documented default, options that
+// the sample doesn't document are kept in their section and removed options
+// are kept commented out for reference.
+func (m *configMigration) merge() string {
+	values := configValues(m.live)
+	set := make(map[string][]string)
+	for _, v := range values {
+		set[v.key] = append(set[v.key], v.value)
+	}
+
+	emitted := make(map[string]bool)
+	var lines []string
+	sample := strings.TrimRight(m.sample, "\n")
+	for _, line := range strings.Split(sample, "\n") {
+		km := configKeyRE.FindStringSubmatch(strings.TrimSpace(line))
+		if km == nil || set[km[1]] == nil {
+			lines = append(lines, line)
+			continue
+		}
+		key := km[1]
+		if emitted[key] {
+			// Only the first documented default is replaced.
+			if !strings.HasPrefix(strings.TrimSpace(line), ";") {
+				line = "; " + line
+			}
+			lines = append(lines, line)
+			continue
+		}
+		for _, v := range set[key] {
+			lines = append(lines, key+"="+v)
+		}
+		emitted[key] = true
+	}
+
+	// Options the new sample doesn't document, in the section they were
+	// set in.
+	for _, v := range values {
+		if emitted[v.key] {
+			continue
+		}
+		line := v.key + "=" + v.value
+		if _, removed := m.oldOptions[v.key]; removed {
+			line = fmt.Sprintf("; %v (removed in %v)", line, m.To)
+		}
+		lines = insertInSection(lines, v.section, line)
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// insertInSection inserts line at the end of the provided config section.
+// Options without a section go before the first section. A missing section
+// is added at the end.
+func insertInSection(lines []string, section, line string) []string {
+	insert := -1
+	current := ""
+	for k, l := range lines {
+		l = strings.TrimSpace(l)
+		if strings.HasPrefix(l, "[") && strings.HasSuffix(l, "]") {
+			if section == "" {
+				insert = k
+				break
+			}
+			current = l
+			if current == section {
+				insert = k + 1
+			}
+			continue
+		}
+		if current == section && section != "" {
+			insert = k + 1
+		}
+	}
+	switch {
+	case insert == -1 && section == "":
+		insert = len(lines)
+	case insert == -1:
+		lines = append(lines, "", section)
+		insert = len(lines)
+	}
+
+	lines = append(lines, "")
+	copy(lines[insert+1:], lines[insert:])
+	lines[insert] = line
+	return lines
+}
+
+// bundleConfigMigration returns how the sample config of the provided file
+// changed since the previously installed bundle version. It returns nil when
+// there is nothing to compare.
+func bundleConfigMigration(b *bundleInfo, f decredFiles,
+	from string) (*configMigration, error) {
+
+	if f.SampleFilename == "" || from == "" || from == b.Version {
+		return nil, nil
+	}
+
+	oldSample := filepath.Join(destination, b.bundleDir(from),
+		f.SampleFilename)
+	newSample := filepath.Join(extractedBundle(b.bundleDir(b.Version)),
+		f.SampleFilename)
+	oldData, err := os.ReadFile(oldSample)
+	if err != nil {
+		log.Printf("No previous sample configuration, skipping "+
+			"configuration migration: %v", err)
+		return nil, nil
+	}
+	newData, err := os.ReadFile(newSample)
+	if err != nil {
+		return nil, err
+	}
+	config := configPath(f.Config)
+	live, err := os.ReadFile(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return newConfigMigration(config, from, b.Version, string(oldData),
+		string(newData), string(live)), nil
+}
+
+// migrateConfig reports how the sample config of the provided file changed
+// since the previously installed bundle version and, if requested, merges
+// the options that are set in the live config into the new sample config. A
+// backup of the live config is written before it is replaced.
+func migrateConfig(b *bundleInfo, f decredFiles, from string) error {
+	m, err := bundleConfigMigration(b, f, from)
+	if err != nil || m == nil {
+		return err
+	}
+	config := m.Config
+	live := []byte(m.live)
+	if !m.changed() {
+		log.Printf("Configuration unchanged from %v to %v: %v", from,
+			b.Version, config)
+		return nil
+	}
+	report := m.report()
+	for _, l := range strings.Split(strings.TrimSpace(report), "\n") {
+		log.Print(strings.TrimSpace(l))
+	}
+	if !mergeConfigs {
+		postProcess = append(postProcess, "\n"+report+
+			"\tRun with --mergeconfigs to merge your settings "+
+			"into the new sample configuration.\n")
+		return nil
+	}
+
+	backup := fmt.Sprintf("%v.%v.bak", config,
+		time.Now().Format("20060102150405"))
+	log.Printf("Backing up configuration file: %v", backup)
+	err = os.WriteFile(backup, live, 0600)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Merging configuration file: %v", config)
+	tmp := config + ".tmp"
+	err = os.WriteFile(tmp, []byte(m.merge()), 0600)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmp, config)
+	if err != nil {
+		return err
+	}
+	postProcess = append(postProcess, "\n"+report+
+		fmt.Sprintf("\tMerged into the new sample configuration, the "+
+			"previous configuration was saved as %v\n", backup))
+
+	return nil
+}
@@ -0,0 +1,150 @@
+// Copyright (c) 2022 The Decred developers
+// Use of this source code is governed by an ISC license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestInsertInSection ensures lines are inserted at the end of their section.
+func TestInsertInSection(t *testing.T) {
+	config := []string{
+		"; comment",
+		"[Application Options]",
+		"a=1",
+		"",
+		"[Other]",
+		"b=2",
+	}
+	tests := []struct {
+		name    string
+		section string
+		want    []string
+	}{
+		{"no section", "", []string{"; comment", "x=1",
+			"[Application Options]", "a=1", "", "[Other]", "b=2"}},
+		{"first section", "[Application Options]", []string{
+			"; comment", "[Application Options]", "a=1", "", "x=1",
+			"[Other]", "b=2"}},
+		{"last section", "[Other]", []string{"; comment",
+			"[Application Options]", "a=1", "", "[Other]", "b=2",
+			"x=1"}},
+		{"missing section", "[New]", []string{"; comment",
+			"[Application Options]", "a=1", "", "[Other]", "b=2", "",
+			"[New]", "x=1"}},
+	}
+	for _, test := range tests {
+		lines := append([]string(nil), config...)
+		got := insertInSection(lines, test.section, "x=1")
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v: got %q, want %q", test.name, got, test.want)
+		}
+	}
+
+	got := insertInSection([]string{"a=1"}, "", "x=1")
+	if want := []string{"a=1", "x=1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("no sections: got %q, want %q", got, want)
+	}
+}
+
+// TestConfigMigration ensures changes of the sample config are reported and
+// that merging keeps every option that is set in the live config.
+func TestConfigMigration(t *testing.T) {
+	const (
+		oldSample = "[Application Options]\n" +
+			"; rpcuser=\n" +
+			"; rpcpass=\n" +
+			"; oldopt=1\n" +
+			"; legacy=0\n" +
+			"\n" +
+			"[Other]\n" +
+			"; other=0\n"
+
+		newSample = "[Application Options]\n" +
+			"; rpcuser=\n" +
+			"; rpcpass=\n" +
+			"; newopt=1\n" +
+			"\n" +
+			"; DEPRECATED: use newopt instead.\n" +
+			"; legacy=0\n" +
+			"\n" +
+			"[Other]\n" +
+			"; other=0\n"
+
+		live = "[Application Options]\n" +
+			"rpcuser=user\n" +
+			"rpcpass=pass\n" +
+			"oldopt=2\n" +
+			"legacy=1\n" +
+			"custom=3\n" +
+			"\n" +
+			"[Other]\n" +
+			"other=1\n"
+	)
+
+	m := newConfigMigration("dcrd.conf", "v2.0.0", "v2.1.0", oldSample,
+		newSample, live)
+	if !m.changed() {
+		t.Fatal("expected changes")
+	}
+	if want := []string{"newopt"}; !reflect.DeepEqual(m.Added, want) {
+		t.Errorf("added: got %v, want %v", m.Added, want)
+	}
+	if want := []string{"legacy"}; !reflect.DeepEqual(m.Deprecated,
+		want) {
+
+		t.Errorf("deprecated: got %v, want %v", m.Deprecated, want)
+	}
+	if want := []string{"oldopt"}; !reflect.DeepEqual(m.Removed, want) {
+		t.Errorf("removed: got %v, want %v", m.Removed, want)
+	}
+	report := m.report()
+	for _, s := range []string{"from v2.0.0 to v2.1.0 for dcrd.conf",
+		"New options: newopt", "Deprecated options that are set: legacy",
+		"Removed options that are set: oldopt"} {
+
+		if !strings.Contains(report, s) {
+			t.Errorf("report does not contain %q:\n%v", s, report)
+		}
+	}
+
+	want := "[Application Options]\n" +
+		"rpcuser=user\n" +
+		"rpcpass=pass\n" +
+		"; newopt=1\n" +
+		"\n" +
+		"; DEPRECATED: use newopt instead.\n" +
+		"legacy=1\n" +
+		"\n" +
+		"; oldopt=2 (removed in v2.1.0)\n" +
+		"custom=3\n" +
+		"[Other]\n" +
+		"other=1\n"
+	if got := m.merge(); got != want {
+		t.Errorf("merge: got\n%v\nwant\n%v", got, want)
+	}
+
+	unchanged := newConfigMigration("dcrd.conf", "v2.0.0", "v2.1.0",
+		oldSample, oldSample, live)
+	if unchanged.changed() {
+		t.Errorf("unchanged sample reported changes: %v",
+			unchanged.report())
+	}
+}
+
+// TestConfigValues ensures only options that are set are returned, with the
+// section they are set in.
+func TestConfigValues(t *testing.T) {
+	config := "a=1\n; b=2\n# c=3\n[S]\n  d = 4 \ninvalid line\n"
+	want := []configValue{
+		{key: "a", value: "1"},
+		{key: "d", value: "4", section: "[S]"},
+	}
+	if got := configValues(config); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,368 @@
+// Copyright (c) 2022 The Decred developers
+// Use of this source code is governed by an ISC license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/openpgp/clearsign"
+)
+
+// signedSuffix is appended to the name of the latest manifest to name the
+// signed upstream copy that a mirror keeps next to its rewritten latest
+// manifest.
+const signedSuffix = ".signed"
+
+// manifestEntry is a single "<sha256> <name>" line of a manifest.
+type manifestEntry struct {
+	Digest string
+	Name   string // Filename or URI
+}
+
+// readManifest returns all entries of a bundle manifest.
+func readManifest(filename string) ([]manifestEntry, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []manifestEntry
+	br := bufio.NewReader(f)
+	for i := 1; ; i++ {
+		line, err := br.ReadString('\n')
+		if errors.Is(err, io.EOF) && line == "" {
+			break
+		}
+		a := strings.Fields(line)
+		switch len(a) {
+		case 0:
+			continue
+		case 2:
+		default:
+			return nil, fmt.Errorf("invalid manifest %v line %v",
+				filename, i)
+		}
+		entries = append(entries, manifestEntry{Digest: a[0], Name: a[1]})
+	}
+
+	return entries, nil
+}
+
+// isClearSigned returns true if the provided file contains a clear signed
+// message.
+func isClearSigned(filename string) (bool, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return false, err
+	}
+	b, _ := clearsign.Decode(data)
+	return b != nil, nil
+}
+
+// verifyLatest verifies the signature of the downloaded latest manifest and
+// returns the filename of the signed latest manifest. A latest manifest that
+// was rewritten by 'dcrinstall mirror' is not signed. In that case the signed
+// upstream copy the mirror serves next to it is verified instead and both
+// must list the same digests and filenames, only the locations may differ.
+func verifyLatest(filename string) (string, error) {
+	signed, err := isClearSigned(filename)
+	if err != nil {
+		return "", err
+	}
+	if signed {
+		return filename, verifyLatestSignature(filename)
+	}
+
+	log.Printf("Latest manifest is not signed, verifying mirrored copy")
+	signedFilename := filename + signedSuffix
+	err = DownloadFile(latestManifestURI+signedSuffix, signedFilename)
+	if err != nil {
+		return "", fmt.Errorf("Download signed latest manifest: %v", err)
+	}
+	err = verifyLatestSignature(signedFilename)
+	if err != nil {
+		return "", err
+	}
+
+	return signedFilename, matchLatest(filename, signedFilename)
+}
+
+// matchLatest returns an error unless the mirrored latest manifest lists the
+// same digests and filenames as the signed upstream latest manifest.
+func matchLatest(mirroredFilename, upstreamFilename string) error {
+	mirrored, err := readLatest(mirroredFilename)
+	if err != nil {
+		return err
+	}
+	upstream, err := readLatest(upstreamFilename)
+	if err != nil {
+		return err
+	}
+	if len(mirrored.Entries) != len(upstream.Entries) {
+		return fmt.Errorf("mirrored latest manifest does not match " +
+			"signed copy")
+	}
+	for k, u := range upstream.Entries {
+		m := mirrored.Entries[k]
+		if m.Digest != u.Digest || path.Base(m.URI) != path.Base(u.URI) {
+			return fmt.Errorf("mirrored latest manifest does not "+
+				"match signed copy: %v", m.URI)
+		}
+	}
+
+	return nil
+}
+
+// mirrorFile downloads the file with the provided digest into dir unless a
+// file with the same name and digest already exists there. The uris are tried
+// in order until one of them succeeds.
+func mirrorFile(dir, digest string, uris ...string) error {
+	filename := filepath.Join(dir, path.Base(uris[0]))
+	if exists(filename) && sha256Verify(filename, digest) == nil {
+		log.Printf("Already mirrored: %v", filename)
+		return nil
+	}
+
+	var err error
+	for _, uri := range uris {
+		err = downloadVerified(uri, filename, digest)
+		if err == nil {
+			return nil
+		}
+		log.Printf("Mirror %v: %v", uri, err)
+	}
+
+	return fmt.Errorf("%v: %v", filename, err)
+}
+
+// mirrorSignature downloads the signature of the provided manifest into dir
+// unless it exists already and verifies the manifest. The signature is looked
+// up next to each of the uris in order until one of them verifies.
+func mirrorSignature(dir string, uris ...string) error {
+	manifest := filepath.Join(dir, path.Base(uris[0]))
+	signature := manifest + ".asc"
+	if exists(signature) && pgpVerify(signature, manifest) == nil {
+		log.Printf("Already mirrored: %v", signature)
+		return nil
+	}
+
+	var err error
+	for _, uri := range uris {
+		err = DownloadFile(uri+".asc", signature)
+		if err != nil {
+			log.Printf("Mirror %v: %v", uri+".asc", err)
+			continue
+		}
+		err = pgpVerify(signature, manifest)
+		if err == nil {
+			return nil
+		}
+		os.Remove(signature)
+		err = fmt.Errorf("manifest PGP signature incorrect %v: %v",
+			manifest, err)
+		log.Printf("Mirror %v: %v", uri+".asc", err)
+	}
+
+	return err
+}
+
+// sourceURIs returns the locations of every entry of the signed latest
+// manifest, keyed by digest, that the downloaded latest manifest lists. They
+// differ from the origin only when the downloaded latest manifest was
+// rewritten by 'dcrinstall mirror', verifyLatest asserted that both list the
+// same files in that case.
+func sourceURIs(downloaded, signed string) (map[string]string, error) {
+	if downloaded == signed {
+		return nil, nil
+	}
+	mirrored, err := readLatest(downloaded)
+	if err != nil {
+		return nil, err
+	}
+	uris := make(map[string]string, len(mirrored.Entries))
+	for _, e := range mirrored.Entries {
+		uris[e.Digest] = e.URI
+	}
+	return uris, nil
+}
+
+// writeFileAtomic writes data to filename by way of a temporary file.
+func writeFileAtomic(filename string, data []byte) error {
+	err := os.WriteFile(filename+".tmp", data, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(filename+".tmp", filename)
+}
+
+// mirror downloads and verifies the latest manifest, every manifest it
+// references with their signatures and every file listed in those manifests
+// for all OS-Arch tuples into a flat directory. The latest manifest is
+// rewritten to point at baseURL and the signed upstream copy is kept next to
+// it so that clients can still verify it. Files that are already present and
+// verified are not downloaded again.
+func mirror(args []string) error {
+	fs := flag.NewFlagSet("mirror", flag.ContinueOnError)
+	baseURLF := fs.String("baseurl", "", "URL the mirror directory is "+
+		"served from, e.g. http://mirror.lan/decred/ (default "+
+		"file://<dir>/)")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: mirror [-baseurl <url>] <dir>")
+	}
+	if latestManifestURI == "" {
+		return fmt.Errorf("mirror requires a latest manifest")
+	}
+
+	dir, err := filepath.Abs(cleanAndExpandPath(fs.Arg(0)))
+	if err != nil {
+		return err
+	}
+	baseURL := *baseURLF
+	if baseURL == "" {
+		baseURL = "file://" + filepath.ToSlash(dir)
+	}
+	if !strings.HasSuffix(baseURL, "/") {
+		baseURL += "/"
+	}
+
+	log.Printf("=== dcrinstall mirror start ===")
+	log.Printf("Mirror directory: %v", dir)
+	log.Printf("Mirror base URL: %v", baseURL)
+
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	// Always fetch the latest manifest, it is what changes between
+	// releases.
+	latestName := path.Base(latestManifestURI)
+	downloaded := filepath.Join(dir, latestName+".new")
+	defer os.Remove(downloaded)
+	err = DownloadFile(latestManifestURI, downloaded)
+	if err != nil {
+		return err
+	}
+	signed := downloaded
+	if !skipPGP {
+		// A mirror of a mirror keeps the upstream signed copy.
+		signed, err = verifyLatest(downloaded)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(downloaded + signedSuffix)
+
+		// Mirror the key transition statements, if any, so that
+		// clients of the mirror can follow a key rotation.
+		keys, err := fetchTransitions()
+		if err != nil {
+			log.Printf("No key transition statements: %v", err)
+		} else {
+			err = writeFileAtomic(filepath.Join(dir,
+				latestName+transitionSuffix), keys)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	latest, err := readLatest(signed)
+	if err != nil {
+		return err
+	}
+	latest.warn()
+
+	// When mirroring a mirror, download from the source mirror first and
+	// fall back to the origin.
+	sources, err := sourceURIs(downloaded, signed)
+	if err != nil {
+		return err
+	}
+
+	// Manifests, their signatures and everything they list.
+	for _, e := range latest.Entries {
+		uris := []string{e.URI}
+		if source, ok := sources[e.Digest]; ok && source != e.URI {
+			uris = []string{source, e.URI}
+		}
+		err = mirrorFile(dir, e.Digest, uris...)
+		if err != nil {
+			return err
+		}
+		if !skipPGP {
+			err = mirrorSignature(dir, uris...)
+			if err != nil {
+				return err
+			}
+		}
+
+		manifest, err := readManifest(filepath.Join(dir,
+			path.Base(e.URI)))
+		if err != nil {
+			return err
+		}
+		downloadURIs := make([]string, 0, len(uris))
+		for _, uri := range uris {
+			downloadURI, err := getDownloadURI(uri)
+			if err != nil {
+				return err
+			}
+			downloadURIs = append(downloadURIs, downloadURI)
+		}
+		for _, m := range manifest {
+			fileURIs := make([]string, 0, len(downloadURIs))
+			for _, downloadURI := range downloadURIs {
+				fileURIs = append(fileURIs, downloadURI+m.Name)
+			}
+			err = mirrorFile(dir, m.Digest, fileURIs...)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// Publish the latest manifest last so that it never references
+	// files that are not mirrored yet.
+	var rewritten string
+	for _, e := range latest.Entries {
+		rewritten += fmt.Sprintf("%v  %v%v\n", e.Digest, baseURL,
+			path.Base(e.URI))
+	}
+	data, err := os.ReadFile(signed)
+	if err != nil {
+		return err
+	}
+	err = writeFileAtomic(filepath.Join(dir, latestName+signedSuffix), data)
+	if err != nil {
+		return err
+	}
+	err = writeFileAtomic(filepath.Join(dir, latestName), []byte(rewritten))
+	if err != nil {
+		return err
+	}
+
+	log.Printf("=== dcrinstall mirror complete ===")
+
+	if !quiet {
+		fmt.Printf("\nRelease mirrored to %v\n\n"+
+			"To install from it use: dcrinstall -manifest %v%v\n",
+			dir, baseURL, latestName)
+	}
+
+	return nil
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2022 The Decred developers
+// Use of this source code is governed by an ISC license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestMirrorFile ensures files are downloaded from the first location that
+// serves them and that mirrored files are not downloaded again.
+func TestMirrorFile(t *testing.T) {
+	oldCacheDir := cacheDir
+	t.Cleanup(func() {
+		cacheDir = oldCacheDir
+	})
+	cacheDir = ""
+
+	src, origin, dir := t.TempDir(), t.TempDir(), t.TempDir()
+	d := sha256.Sum256([]byte("origin"))
+	digest := hex.EncodeToString(d[:])
+	writeTestFile(t, filepath.Join(origin, "decred.tar.gz"), "origin")
+
+	// The source mirror doesn't serve the file, fall back to the origin.
+	uris := []string{"file://" + filepath.Join(src, "decred.tar.gz"),
+		"file://" + filepath.Join(origin, "decred.tar.gz")}
+	if err := mirrorFile(dir, digest, uris...); err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(dir, "decred.tar.gz")
+	if err := sha256Verify(filename, digest); err != nil {
+		t.Fatal(err)
+	}
+
+	// Already mirrored, neither location is needed.
+	os.Remove(uris[1][len("file://"):])
+	if err := mirrorFile(dir, digest, uris...); err != nil {
+		t.Fatal(err)
+	}
+
+	// No location serves the file.
+	os.Remove(filename)
+	if err := mirrorFile(dir, digest, uris...); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+// TestSourceURIs ensures a rewritten latest manifest provides the locations
+// of the source mirror and that a signed one doesn't override the origin.
+func TestSourceURIs(t *testing.T) {
+	d1 := strings.Repeat("a1", 32)
+	d2 := strings.Repeat("b2", 32)
+	dir := t.TempDir()
+	downloaded := filepath.Join(dir, "latest")
+	writeTestFile(t, downloaded,
+		d1+"  http://mirror.lan/decred/decred-v2.1.0-manifest.txt\n"+
+			d2+"  http://mirror.lan/decred/bisonwallet-v1.0.7-"+
+			"manifest.txt\n")
+
+	got, err := sourceURIs(downloaded, downloaded+signedSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		d1: "http://mirror.lan/decred/decred-v2.1.0-manifest.txt",
+		d2: "http://mirror.lan/decred/bisonwallet-v1.0.7-manifest.txt",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	got, err = sourceURIs(downloaded, downloaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != nil {
+		t.Errorf("signed: got %v, want none", got)
+	}
+}
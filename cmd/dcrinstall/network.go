@@ -0,0 +1,136 @@
+// Copyright (c) 2022 The Decred developers
+// Use of this source code is governed by an ISC license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+const defaultNetwork = "mainnet"
+
+// networkDirs maps the supported network names to the name of the per
+// network directory that dcrwallet and dcrlnd create in their data
+// directories.
+var networkDirs = map[string]string{
+	"mainnet": "mainnet",
+	"testnet": "testnet3",
+	"simnet":  "simnet",
+	"regnet":  "regnet",
+}
+
+// validateNetwork returns an error if the provided network is not supported.
+func validateNetwork(net string) error {
+	if _, ok := networkDirs[net]; ok {
+		return nil
+	}
+	nets := make([]string, 0, len(networkDirs))
+	for k := range networkDirs {
+		nets = append(nets, k)
+	}
+	sort.Strings(nets)
+	return fmt.Errorf("invalid network %q, must be one of: %v", net,
+		strings.Join(nets, ", "))
+}
+
+// networkDir returns the per network data directory name of the provided
+// network.
+func networkDir(net string) string {
+	if dir, ok := networkDirs[net]; ok {
+		return dir
+	}
+	return net
+}
+
+// networkArgs returns the command line arguments that select the provided
+// network. Mainnet is the default and requires no arguments.
+func networkArgs(net string) []string {
+	if net == "" || net == defaultNetwork {
+		return nil
+	}
+	return []string{"--" + net}
+}
+
+// appNetworks lists the networks other than mainnet that the applications
+// with a configuration file can select. dcrd is the only one that knows
+// about regnet.
+var appNetworks = map[string][]string{
+	"dcrd":          {"testnet", "simnet", "regnet"},
+	"dcrctl":        {"testnet", "simnet"},
+	"dcrwallet":     {"testnet", "simnet"},
+	"dcrlnd":        {"testnet", "simnet"},
+	"politeiavoter": {"testnet"},
+	"bisonw":        {"testnet", "simnet"},
+	"bwctl":         {"testnet", "simnet"},
+}
+
+// supportsNetwork returns true if the provided application can select the
+// provided network.
+func supportsNetwork(name, net string) bool {
+	if net == "" || net == defaultNetwork {
+		return true
+	}
+	for _, v := range appNetworks[name] {
+		if v == net {
+			return true
+		}
+	}
+	return false
+}
+
+// checkNetworkSupport returns an error if any application with a
+// configuration file can't select the provided network. Installing such a
+// set of applications results in applications on different networks that
+// can't talk to each other, so it has to be allowed explicitly with partial.
+func checkNetworkSupport(net string, partial bool) error {
+	var apps []string
+	for app := range overrideApplications() {
+		if !supportsNetwork(app, net) {
+			apps = append(apps, app)
+		}
+	}
+	if len(apps) == 0 || partial {
+		return nil
+	}
+	sort.Strings(apps)
+	return fmt.Errorf("%v does not support %v, use --partialnetwork to "+
+		"leave them on %v", strings.Join(apps, ", "), net,
+		defaultNetwork)
+}
+
+// networkOverrides returns the config file overrides that select the
+// provided network for the provided application. The returned bool is false
+// when the application can't select the network. The sample config must
+// contain the network option, otherwise generating the config fails.
+func networkOverrides(name, net string) ([]override, bool) {
+	if !supportsNetwork(name, net) {
+		return nil, false
+	}
+	if net == "" || net == defaultNetwork {
+		return nil, true
+	}
+	return []override{{name: "; " + net + "=", content: "1",
+		required: true}}, true
+}
+
+// unsupportedNetwork returns the message that is shown when the provided
+// application can't select the provided network.
+func unsupportedNetwork(name, net string) string {
+	return fmt.Sprintf("%v does not support %v, its configuration is "+
+		"left on %v", name, net, defaultNetwork)
+}
+
+// warnUnsupportedNetwork logs and reports at the end of the install that the
+// provided application can't select the selected network.
+func warnUnsupportedNetwork(name string) {
+	if supportsNetwork(name, network) {
+		return
+	}
+	msg := unsupportedNetwork(name, network)
+	log.Printf("WARNING: %v", msg)
+	postProcess = append(postProcess, "\nWARNING: "+msg+"\n")
+}
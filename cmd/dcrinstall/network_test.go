@@ -0,0 +1,74 @@
+// Copyright (c) 2022 The Decred developers
+// Use of this source code is governed by an ISC license that can be found in
+// the LICENSE file.
+
+package main
+
+import "testing"
+
+// TestNetworkOverrides ensures only networks an application supports are
+// selected in its configuration.
+func TestNetworkOverrides(t *testing.T) {
+	tests := []struct {
+		app  string
+		net  string
+		want string
+		ok   bool
+	}{
+		{"dcrd", "mainnet", "", true},
+		{"dcrd", "", "", true},
+		{"dcrd", "testnet", "; testnet=", true},
+		{"dcrd", "regnet", "; regnet=", true},
+		{"dcrwallet", "simnet", "; simnet=", true},
+		{"dcrwallet", "regnet", "", false},
+		{"dcrctl", "regnet", "", false},
+		{"politeiavoter", "testnet", "; testnet=", true},
+		{"politeiavoter", "simnet", "", false},
+		{"bisonw", "regnet", "", false},
+		{"unknown", "testnet", "", false},
+	}
+	for _, test := range tests {
+		overrides, ok := networkOverrides(test.app, test.net)
+		if ok != test.ok {
+			t.Errorf("%v %v: got ok %v, want %v", test.app, test.net,
+				ok, test.ok)
+			continue
+		}
+		var got string
+		if len(overrides) == 1 {
+			got = overrides[0].name
+			if !overrides[0].required {
+				t.Errorf("%v %v: network override not required",
+					test.app, test.net)
+			}
+		}
+		if len(overrides) > 1 || got != test.want {
+			t.Errorf("%v %v: got %v, want %v", test.app, test.net,
+				overrides, test.want)
+		}
+	}
+}
+
+// TestCheckNetworkSupport ensures a network that an application doesn't
+// support is refused unless explicitly allowed.
+func TestCheckNetworkSupport(t *testing.T) {
+	tests := []struct {
+		net     string
+		partial bool
+		fail    bool
+	}{
+		{"mainnet", false, false},
+		{"testnet", false, false},
+		{"simnet", false, true},
+		{"simnet", true, false},
+		{"regnet", false, true},
+		{"regnet", true, false},
+	}
+	for _, test := range tests {
+		err := checkNetworkSupport(test.net, test.partial)
+		if (err != nil) != test.fail {
+			t.Errorf("%v partial %v: got error %v, want failure %v",
+				test.net, test.partial, err, test.fail)
+		}
+	}
+}
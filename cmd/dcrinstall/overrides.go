@@ -0,0 +1,140 @@
+// Copyright (c) 2022 The Decred developers
+// Use of this source code is governed by an ISC license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// userOverrides are the config file overrides per application that are read
+// from the file provided with --overrides.
+var userOverrides map[string][]override
+
+// overrideApplications returns the applications whose config files can be
+// overridden.
+func overrideApplications() map[string]bool {
+	apps := make(map[string]bool)
+	for _, files := range [][]decredFiles{df, dexf} {
+		for _, f := range files {
+			if f.Config != "" {
+				apps[f.Name] = true
+			}
+		}
+	}
+	return apps
+}
+
+// loadOverrides reads a config overrides file. It contains a section per
+// application, named after its binary, with the options to set:
+//
+//	[dcrd]
+//	txindex=1
+//
+//	[dcrwallet]
+//	enablevoting=1
+//
+// Lines starting with ';' or '#' are comments.
+func loadOverrides(filename string) (map[string][]override, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	apps := overrideApplications()
+	overrides := make(map[string][]override)
+	var app string
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "", strings.HasPrefix(line, ";"),
+			strings.HasPrefix(line, "#"):
+			continue
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			app = strings.TrimSpace(line[1 : len(line)-1])
+			if !apps[app] {
+				return nil, fmt.Errorf("%v:%v: unknown application "+
+					"%q", filename, n, app)
+			}
+			continue
+		case app == "":
+			return nil, fmt.Errorf("%v:%v: override outside of an "+
+				"application section", filename, n)
+		}
+
+		kv := strings.SplitN(line, "=", 2)
+		key := strings.TrimSpace(kv[0])
+		if len(kv) != 2 || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("%v:%v: invalid override: %v",
+				filename, n, line)
+		}
+		overrides[app] = append(overrides[app], override{
+			name:    "; " + key + "=",
+			content: strings.TrimSpace(kv[1]),
+			add:     true,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return overrides, nil
+}
+
+// withUserOverrides returns the provided overrides of an application with the
+// user overrides applied. User overrides replace built-in overrides of the
+// same entry.
+func withUserOverrides(app string, overrides []override) []override {
+	user := userOverrides[app]
+	if len(user) == 0 {
+		return overrides
+	}
+
+	replaced := make(map[string]bool)
+	for _, o := range user {
+		replaced[o.name] = true
+	}
+	rv := make([]override, 0, len(overrides)+len(user))
+	for _, o := range overrides {
+		if !replaced[o.name] {
+			rv = append(rv, o)
+		}
+	}
+	for _, o := range user {
+		key := strings.TrimSuffix(strings.TrimPrefix(o.name, "; "), "=")
+		value := o.content
+		if secretKey(key) {
+			value = maskedSecret
+		}
+		log.Printf("Configuration override %v: %v=%v", app, key, value)
+		rv = append(rv, o)
+	}
+	return rv
+}
+
+// secretKey returns true if the provided config option holds a secret.
+func secretKey(key string) bool {
+	return strings.Contains(strings.ToLower(key), "pass")
+}
+
+// userSecrets returns the secrets that are set by user overrides.
+func userSecrets() []string {
+	var secrets []string
+	for _, overrides := range userOverrides {
+		for _, o := range overrides {
+			key := strings.TrimSuffix(strings.TrimPrefix(o.name,
+				"; "), "=")
+			if secretKey(key) && o.content != "" {
+				secrets = append(secrets, o.content)
+			}
+		}
+	}
+	return secrets
+}
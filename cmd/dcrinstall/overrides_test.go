@@ -0,0 +1,166 @@
+// Copyright (c) 2022 The Decred developers
+// Use of this source code is governed by an ISC license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestLoadOverrides ensures overrides files are parsed per application and
+// that invalid ones are rejected with the offending line.
+func TestLoadOverrides(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    map[string][]override
+		err     string
+	}{{
+		name: "valid",
+		content: "; comment\n" +
+			"# comment\n" +
+			"\n" +
+			"[dcrd]\n" +
+			"txindex=1\n" +
+			"  rpclisten = 127.0.0.1:9109  \n" +
+			"[bisonw]\n" +
+			"rpcpass=\n",
+		want: map[string][]override{
+			"dcrd": {
+				{name: "; txindex=", content: "1", add: true},
+				{name: "; rpclisten=", content: "127.0.0.1:9109",
+					add: true},
+			},
+			"bisonw": {
+				{name: "; rpcpass=", content: "", add: true},
+			},
+		},
+	}, {
+		name:    "empty",
+		content: "",
+		want:    map[string][]override{},
+	}, {
+		name:    "unknown application",
+		content: "[dcrx]\na=1\n",
+		err:     ":1: unknown application \"dcrx\"",
+	}, {
+		name:    "no config",
+		content: "[promptsecret]\na=1\n",
+		err:     ":1: unknown application \"promptsecret\"",
+	}, {
+		name:    "outside section",
+		content: "a=1\n",
+		err:     ":1: override outside of an application section",
+	}, {
+		name:    "no value",
+		content: "[dcrd]\n\ntxindex\n",
+		err:     ":3: invalid override: txindex",
+	}, {
+		name:    "no key",
+		content: "[dcrd]\n=1\n",
+		err:     ":2: invalid override: =1",
+	}, {
+		name:    "space in key",
+		content: "[dcrd]\ntx index=1\n",
+		err:     ":2: invalid override: tx index=1",
+	}}
+	for _, test := range tests {
+		filename := filepath.Join(t.TempDir(), "overrides.conf")
+		err := os.WriteFile(filename, []byte(test.content), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := loadOverrides(filename)
+		if test.err != "" {
+			if err == nil || !strings.HasSuffix(err.Error(),
+				test.err) {
+
+				t.Errorf("%v: got error %v, want %v", test.name,
+					err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v: got %v, want %v", test.name, got,
+				test.want)
+		}
+	}
+
+	if _, err := loadOverrides(filepath.Join(t.TempDir(),
+		"missing")); err == nil {
+
+		t.Errorf("missing file: expected error")
+	}
+}
+
+// TestWithUserOverrides ensures user overrides replace built-in overrides of
+// the same entry and that their secrets are masked.
+func TestWithUserOverrides(t *testing.T) {
+	oldOverrides, oldPassword := userOverrides, password
+	t.Cleanup(func() {
+		userOverrides, password = oldOverrides, oldPassword
+	})
+	userOverrides = map[string][]override{
+		"dcrd": {
+			{name: "; rpcpass=", content: "secret", add: true},
+			{name: "; txindex=", content: "1", add: true},
+		},
+	}
+	password = "generated"
+
+	builtin := []override{
+		{name: "; rpcuser=", content: "user"},
+		{name: "; rpcpass=", content: "generated"},
+	}
+	want := []override{
+		{name: "; rpcuser=", content: "user"},
+		{name: "; rpcpass=", content: "secret", add: true},
+		{name: "; txindex=", content: "1", add: true},
+	}
+	if got := withUserOverrides("dcrd", builtin); !reflect.DeepEqual(got,
+		want) {
+
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got := withUserOverrides("dcrctl", builtin); !reflect.DeepEqual(got,
+		builtin) {
+
+		t.Errorf("no overrides: got %v, want %v", got, builtin)
+	}
+
+	got := maskSecrets("rpcpass=secret\npassword=generated\ntxindex=1\n")
+	want2 := "rpcpass=" + maskedSecret + "\npassword=" + maskedSecret +
+		"\ntxindex=1\n"
+	if got != want2 {
+		t.Errorf("mask: got %q, want %q", got, want2)
+	}
+}
+
+// TestSecretKey ensures options that hold passwords are recognized.
+func TestSecretKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{"rpcpass", true},
+		{"password", true},
+		{"dcrd.rpcpass", true},
+		{"RPCPass", true},
+		{"rpcuser", false},
+		{"txindex", false},
+	}
+	for _, test := range tests {
+		if got := secretKey(test.key); got != test.want {
+			t.Errorf("%v: got %v, want %v", test.key, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+// Copyright (c) 2022 The Decred developers
+// Use of this source code is governed by an ISC license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// maskedSecret replaces secrets in the printed plan.
+const maskedSecret = "********"
+
+// extractDestination returns the directory bundles are extracted to. A dry
+// run must not modify the destination so bundles are extracted into the
+// download directory instead.
+func extractDestination() string {
+	if dryRun {
+		return tmpDir
+	}
+	return destination
+}
+
+// extractedBundle returns the path of the provided extracted bundle
+// directory. During a dry run it prefers the download directory over the
+// destination.
+func extractedBundle(dir string) string {
+	if dryRun && exists(filepath.Join(tmpDir, dir)) {
+		return filepath.Join(tmpDir, dir)
+	}
+	return filepath.Join(destination, dir)
+}
+
+// maskSecrets replaces the generated password, the passwords that a repair
+// takes over and the secrets that are set by user overrides in s.
+func maskSecrets(s string) string {
+	secrets := append(userSecrets(), password)
+	for _, b := range bundles {
+		secrets = append(secrets, b.RPCPass)
+	}
+	for _, secret := range secrets {
+		if secret == "" {
+			continue
+		}
+		s = strings.ReplaceAll(s, secret, maskedSecret)
+	}
+	return s
+}
+
+// indent indents every line of s with a tab.
+func indent(s string) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	return "\t\t" + strings.Join(lines, "\n\t\t") + "\n"
+}
+
+// installedState returns a human readable description of the currently
+// installed version of the provided file.
+func installedState(f decredFiles) string {
+	filename := binaryPath(f)
+	if !exists(filename) {
+		return "not installed"
+	}
+	if !f.SupportsVersion || runtimeTuple() != tuple {
+		return "installed"
+	}
+	v, err := binaryVersion(filename)
+	if err != nil {
+		return "installed (unknown version)"
+	}
+	return v
+}
+
+// printBundlePlan prints the binaries that would be installed from the
+// provided bundle and whether this is an upgrade or a fresh install.
+func printBundlePlan(name, version string, files []decredFiles) {
+	upgrade := false
+	for _, f := range files {
+		if exists(binaryPath(f)) {
+			upgrade = true
+			break
+		}
+	}
+	mode := "fresh install"
+	if upgrade {
+		mode = "upgrade"
+	}
+
+	fmt.Printf("%v %v (%v):\n", name, version, mode)
+	for _, f := range files {
+		fmt.Printf("\t%v: %v -> %v\n", binaryPath(f), installedState(f),
+			version)
+	}
+}
+
+// maskConfigSecrets masks the values of the options that hold secrets in the
+// provided config in addition to the secrets that maskSecrets replaces.
+func maskConfigSecrets(conf string) string {
+	lines := strings.Split(conf, "\n")
+	for k, l := range lines {
+		m := configKeyRE.FindStringSubmatch(strings.TrimSpace(l))
+		if m == nil || !secretKey(m[1]) {
+			continue
+		}
+		i := strings.Index(l, "=")
+		if strings.TrimSpace(l[i+1:]) != "" {
+			lines[k] = l[:i+1] + maskedSecret
+		}
+	}
+	return maskSecrets(strings.Join(lines, "\n"))
+}
+
+// printConfigPlan prints the configuration file that would be created for
+// the provided file. An existing configuration file is only modified when
+// its sample changed and --mergeconfigs is set, migration returns how it
+// changed and may be nil. The rendered contents are printed with secrets
+// masked.
+func printConfigPlan(f decredFiles, render func() (string, error),
+	migration func() (*configMigration, error)) error {
+
+	if f.Config == "" {
+		return nil
+	}
+	dst := configPath(f.Config)
+	if exists(dst) {
+		var m *configMigration
+		if migration != nil {
+			var err error
+			m, err = migration()
+			if err != nil {
+				return err
+			}
+		}
+		switch {
+		case m == nil || !m.changed():
+			fmt.Printf("\t%v: exists, not modified\n", dst)
+		case mergeConfigs:
+			fmt.Printf("%v", indent(m.report()))
+			fmt.Printf("\t%v: would be backed up and merged into the "+
+				"new sample configuration:\n", dst)
+			fmt.Printf("%v", indent(maskConfigSecrets(m.merge())))
+		default:
+			fmt.Printf("%v", indent(m.report()))
+			fmt.Printf("\t%v: exists, not modified, use "+
+				"--mergeconfigs to merge it into the new sample "+
+				"configuration\n", dst)
+		}
+		return nil
+	}
+	conf, err := render()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("\t%v: would be created with contents:\n", dst)
+	fmt.Printf("%v", indent(maskSecrets(conf)))
+	return nil
+}
+
+// printPlan prints everything an installation would do. It is called at the
+// end of a dry run after the manifests and bundles have been downloaded and
+// verified and the preconditions have been checked.
+func printPlan() error {
+	fmt.Printf("\n=== dcrinstall dry run plan ===\n\n")
+	fmt.Printf("Network: %v\n", network)
+	fmt.Printf("Destination: %v\n", destination)
+	if exists(journalPath()) {
+		fmt.Printf("Interrupted installation would be rolled back: "+
+			"%v\n", journalPath())
+	}
+
+	fmt.Printf("\nDownloads (verified):\n")
+	for _, v := range downloadedURIs {
+		fmt.Printf("\t%v\n", v)
+	}
+
+	fmt.Printf("\nBinaries:\n")
+	for _, b := range bundles {
+		printBundlePlan(b.Title, b.Version, b.Files)
+	}
+
+	if runtimeTuple() != tuple {
+		fmt.Printf("\nInstallation on foreign OS, configuration " +
+			"would be skipped\n")
+	} else {
+		err := printSetupPlan()
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("\n=== dcrinstall dry run complete, nothing was " +
+		"modified ===\n")
+
+	return nil
+}
+
+// printSetupPlan prints the configuration files, client certificates and
+// wallets that would be created.
+func printSetupPlan() error {
+	fmt.Printf("\nConfiguration files:\n")
+	bundle := extractedBundle(decredBundle.bundleDir(decredBundle.Version))
+	previous := decredBundle.activeVersion()
+	for _, f := range df {
+		f := f
+		err := printConfigPlan(f, func() (string, error) {
+			return createConfigFromFile(filepath.Join(bundle,
+				f.SampleFilename), decredConfigOverrides(f.Name))
+		}, func() (*configMigration, error) {
+			return bundleConfigMigration(decredBundle, f, previous)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for _, f := range dexf {
+		f := f
+		err := printConfigPlan(f, func() (string, error) {
+			return createConfigFromMemory(f.SampleMemory,
+				dcrdexConfigOverrides(f.Name))
+		}, nil)
+		if err != nil {
+			return err
+		}
+	}
+	for _, files := range [][]decredFiles{df, dexf} {
+		for _, f := range files {
+			if f.Config != "" && !supportsNetwork(f.Name, network) {
+				fmt.Printf("\t%v\n", unsupportedNetwork(f.Name,
+					network))
+			}
+		}
+	}
+
+	fmt.Printf("\nClient certificates:\n")
+	walletCert := appFileExists("dcrwallet", walletClientsPem)
+	piCert := appFileExists("politeiavoter", clientPem)
+	piKey := appFileExists("politeiavoter", clientKey)
+	switch {
+	case walletCert && piCert && piKey:
+		fmt.Printf("\texist, generation skipped\n")
+	case !walletCert && !piCert && !piKey:
+		fmt.Printf("\tgencerts would create politeiavoter %v and %v "+
+			"and copy the certificate to dcrwallet %v\n", clientPem,
+			clientKey, walletClientsPem)
+	default:
+		fmt.Printf("\tcan't determine client certificate state, " +
+			"installation would fail\n")
+	}
+
+	fmt.Printf("\nWallets:\n")
+	switch {
+	case !supportsNetwork("dcrwallet", network):
+		fmt.Printf("\tdcrwallet: does not support %v, creation "+
+			"skipped\n", network)
+	case walletDBExists(network):
+		fmt.Printf("\tdcrwallet: exists, creation skipped\n")
+	default:
+		fmt.Printf("\tdcrwallet: would be created interactively with "+
+			"'dcrwallet %v'\n", strings.Join(append(
+			[]string{"--create"}, networkArgs(network)...), " "))
+	}
+	if lnWalletDBExists(network) {
+		fmt.Printf("\tdcrlnd: exists, creation skipped\n")
+	} else {
+		fmt.Printf("\tdcrlnd: does not exist, must be created " +
+			"manually after installation\n")
+	}
+
+	return nil
+}
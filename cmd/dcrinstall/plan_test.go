@@ -0,0 +1,31 @@
+// Copyright (c) 2022 The Decred developers
+// Use of this source code is governed by an ISC license that can be found in
+// the LICENSE file.
+
+package main
+
+import "testing"
+
+// TestMaskConfigSecrets ensures the values of secret options are masked in
+// printed configuration files.
+func TestMaskConfigSecrets(t *testing.T) {
+	oldPassword := password
+	t.Cleanup(func() { password = oldPassword })
+	password = "generated"
+
+	config := "[Application Options]\n" +
+		"rpcuser=user\n" +
+		"rpcpass=livesecret\n" +
+		"; rpcpass=\n" +
+		"dcrd.rpcpass = other\n" +
+		"notify=generated\n"
+	want := "[Application Options]\n" +
+		"rpcuser=user\n" +
+		"rpcpass=" + maskedSecret + "\n" +
+		"; rpcpass=\n" +
+		"dcrd.rpcpass =" + maskedSecret + "\n" +
+		"notify=" + maskedSecret + "\n"
+	if got := maskConfigSecrets(config); got != want {
+		t.Errorf("got\n%v\nwant\n%v", got, want)
+	}
+}
@@ -5,6 +5,7 @@
 package main
 
 const (
+	// dcrinstallPubkey is the release signing key.
 	dcrinstallPubkey = `
 -----BEGIN PGP PUBLIC KEY BLOCK-----
 Version: GnuPG v1
@@ -105,3 +106,8 @@ O6GuapL0x1I9SeIk9WX9VRrpZmENhlri
 -----END PGP PUBLIC KEY BLOCK-----
 `
 )
+
+// builtinPubkeys are the keys that are trusted to sign releases. A successor
+// key is added here ahead of a key rotation so that releases signed by either
+// key verify.
+var builtinPubkeys = []string{dcrinstallPubkey}
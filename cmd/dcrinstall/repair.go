@@ -0,0 +1,200 @@
+// Copyright (c) 2022 The Decred developers
+// Use of this source code is governed by an ISC license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+// errMixedVersions is returned when the binaries of a bundle report different
+// versions.
+var errMixedVersions = errors.New("mixed versions installed")
+
+// sortVersions sorts versions in ascending semantic version order.
+func sortVersions(versions []string) {
+	sort.Slice(versions, func(i, j int) bool {
+		c, _ := compareSemVer(versions[i], versions[j])
+		return c < 0
+	})
+}
+
+// formatVersions returns the installed versions and the binaries that report
+// them in ascending version order.
+func formatVersions(installed map[string][]string) string {
+	versions := make([]string, 0, len(installed))
+	for v := range installed {
+		versions = append(versions, v)
+	}
+	sortVersions(versions)
+
+	mixed := make([]string, 0, len(versions))
+	for _, v := range versions {
+		mixed = append(mixed, fmt.Sprintf("%v (%v)", v,
+			strings.Join(installed[v], ", ")))
+	}
+	return strings.Join(mixed, " ")
+}
+
+// checkMixedVersions returns errMixedVersions when the installed binaries of
+// the bundle, keyed by version, report more than one version. In repair mode
+// and during a rollback the install continues instead since it brings every
+// binary to the version of the bundle.
+func (b *bundleInfo) checkMixedVersions(installed map[string][]string,
+	mode preconditionMode) error {
+
+	if len(installed) <= 1 {
+		return nil
+	}
+
+	mixed := formatVersions(installed)
+	if mode == modeRollback {
+		log.Printf("Rollback: %v binaries report mixed versions %v, "+
+			"installing %v for all of them", b.Name, mixed, b.Version)
+		return nil
+	}
+	if !repair {
+		return fmt.Errorf("%w: %v %v, use --repair to install %v "+
+			"for all binaries", errMixedVersions, b.Name, mixed,
+			b.Version)
+	}
+	for v := range installed {
+		c, err := compareSemVer(v, b.Version)
+		if err != nil {
+			return err
+		}
+		if c > 0 && !allowDowngrade {
+			return fmt.Errorf("refusing to repair %v by downgrading "+
+				"%v to %v, use --allow-downgrade to override",
+				b.Name, strings.Join(installed[v], ", "),
+				b.Version)
+		}
+	}
+	log.Printf("Repair: %v binaries report mixed versions %v, installing "+
+		"%v for all of them", b.Name, mixed, b.Version)
+	return nil
+}
+
+// repairBinaries explains how a repair handles the binaries of a partial
+// installation. Every binary of the bundle is installed, so the missing ones
+// are added and the existing ones are replaced.
+func (b *bundleInfo) repairBinaries(installed, missing []string) {
+	for _, filename := range installed {
+		log.Printf("Repair: %v exists, replacing it with %v %v",
+			filename, b.Name, b.Version)
+	}
+	for _, filename := range missing {
+		log.Printf("Repair: %v is missing, installing it from %v %v",
+			filename, b.Name, b.Version)
+	}
+}
+
+// repairConfigs explains how a repair handles the configuration files of a
+// partial installation and takes over the provided RPC credentials of the
+// existing ones of the bundle. Existing configuration files are never
+// modified, only the missing ones are generated.
+func (b *bundleInfo) repairConfigs(installed, missing []string,
+	creds configCredentials) {
+
+	for _, filename := range installed {
+		log.Printf("Repair: %v exists, keeping it untouched", filename)
+	}
+	for _, filename := range missing {
+		log.Printf("Repair: %v is missing, generating it from the %v "+
+			"sample configuration", filename, b.Name)
+	}
+	if creds.user == "" {
+		log.Printf("Repair: no RPC credentials found in the installed "+
+			"%v configuration files, generating new ones", b.Name)
+		return
+	}
+	log.Printf("Repair: using the RPC credentials of %v for generated %v "+
+		"configuration files", creds.source, b.Name)
+	b.RPCUser, b.RPCPass = creds.user, creds.pass
+}
+
+// credentialKeys lists the pairs of keys that hold RPC credentials in the
+// configuration files that dcrinstall generates.
+var credentialKeys = [][2]string{
+	{"rpcuser", "rpcpass"},
+	{"username", "password"},
+	{"dcrd.rpcuser", "dcrd.rpcpass"},
+}
+
+// readConfigCredentials returns the RPC credentials that are set in the
+// provided configuration file. Empty strings are returned when it doesn't
+// set a user and a password.
+func readConfigCredentials(filename string) (string, string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.ContainsAny(line[:1], ";#[") {
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		values[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	if err := scanner.Err(); err != nil {
+		return "", "", err
+	}
+
+	for _, c := range credentialKeys {
+		user, pass := values[c[0]], values[c[1]]
+		if user != "" && pass != "" {
+			return user, pass, nil
+		}
+	}
+	return "", "", nil
+}
+
+// configCredentials are the RPC credentials that are set in a configuration
+// file.
+type configCredentials struct {
+	user   string
+	pass   string
+	source string // Configuration file the credentials are read from
+}
+
+// bundleCredentials returns the RPC credentials of the first of the provided
+// configuration files of a bundle that sets them. The configuration files of
+// a bundle are generated with one pair of credentials, so that its clients
+// can authenticate with its servers, and configuration files that use other
+// credentials are logged. Empty credentials are returned when none of them
+// sets a user and a password.
+func bundleCredentials(filenames []string) configCredentials {
+	var creds configCredentials
+	for _, filename := range filenames {
+		user, pass, err := readConfigCredentials(filename)
+		if err != nil {
+			log.Printf("Repair: %v", err)
+			continue
+		}
+		switch {
+		case user == "":
+			continue
+		case creds.user == "":
+			creds = configCredentials{user, pass, filename}
+		case user != creds.user || pass != creds.pass:
+			log.Printf("Repair: %v uses different RPC credentials "+
+				"than %v", filename, creds.source)
+		}
+	}
+	return creds
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2022 The Decred developers
+// Use of this source code is governed by an ISC license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestBundleCredentials ensures the RPC credentials of a bundle are taken
+// from the first of its configuration files that sets them.
+func TestBundleCredentials(t *testing.T) {
+	dir := t.TempDir()
+	configs := map[string]string{
+		"dcrd.conf":      "[Application Options]\nrpcuser=u1\nrpcpass=p1\n",
+		"dcrwallet.conf": "username=u1\npassword=p1\n",
+		"dcrlnd.conf":    "dcrd.rpcuser=u2\ndcrd.rpcpass=p2\n",
+		"dcrctl.conf":    "; rpcuser=\n; rpcpass=\n",
+		"dexc.conf":      "rpc=1\nrpcuser = u3\nrpcpass = p3\n",
+		"user.conf":      "rpcuser=u4\n",
+	}
+	for name, content := range configs {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(content),
+			0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := func(names ...string) []string {
+		var paths []string
+		for _, name := range names {
+			paths = append(paths, filepath.Join(dir, name))
+		}
+		return paths
+	}
+
+	tests := []struct {
+		name   string
+		files  []string
+		user   string
+		pass   string
+		source string
+	}{
+		{"first", path("dcrd.conf", "dcrwallet.conf"), "u1", "p1",
+			"dcrd.conf"},
+		{"commented out", path("dcrctl.conf", "dcrwallet.conf"), "u1",
+			"p1", "dcrwallet.conf"},
+		{"different", path("dcrlnd.conf", "dcrd.conf"), "u2", "p2",
+			"dcrlnd.conf"},
+		{"dexc", path("dexc.conf"), "u3", "p3", "dexc.conf"},
+		{"user only", path("user.conf"), "", "", ""},
+		{"missing", path("missing.conf", "dexc.conf"), "u3", "p3",
+			"dexc.conf"},
+		{"none", nil, "", "", ""},
+	}
+	for _, test := range tests {
+		creds := bundleCredentials(test.files)
+		source := ""
+		if creds.source != "" {
+			source = filepath.Base(creds.source)
+		}
+		if creds.user != test.user || creds.pass != test.pass ||
+			source != test.source {
+
+			t.Errorf("%v: got %v/%v from %q, want %v/%v from %q",
+				test.name, creds.user, creds.pass, source,
+				test.user, test.pass, test.source)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright (c) 2022 The Decred developers
+// Use of this source code is governed by an ISC license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// activeFilename is the name of the file in the destination directory that
+// records which bundle versions are currently installed.
+const activeFilename = "dcrinstall.active"
+
+// versions returns the versions of the bundle that have been extracted into
+// the destination directory.
+func (b *bundleInfo) versions() ([]string, error) {
+	entries, err := os.ReadDir(destination)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	prefix := b.Prefix + "-" + tuple + "-"
+	var versions []string
+	for _, e := range entries {
+		if !e.IsDir() || !strings.HasPrefix(e.Name(), prefix) {
+			continue
+		}
+		v, err := extractSemVer(strings.TrimPrefix(e.Name(), prefix))
+		if err != nil || b.bundleDir(v.String()) != e.Name() {
+			continue
+		}
+		versions = append(versions, v.String())
+	}
+	sortVersions(versions)
+
+	return versions, nil
+}
+
+// activeVersion returns the currently installed version of the bundle. It
+// uses the recorded version and falls back to asking the installed binaries.
+func (b *bundleInfo) activeVersion() string {
+	active, err := readActive()
+	if err != nil {
+		log.Printf("Read active versions: %v", err)
+	}
+	if v, ok := active[b.Name]; ok {
+		return v
+	}
+
+	for k := range b.Files {
+		if !b.Files[k].SupportsVersion {
+			continue
+		}
+		v, err := binaryVersion(filepath.Join(destination,
+			b.Files[k].Name))
+		if err != nil {
+			return ""
+		}
+		return v
+	}
+	return ""
+}
+
+// binaryVersion returns the version reported by the provided binary.
+func binaryVersion(filename string) (string, error) {
+	cmd := exec.Command(filename, "--version")
+	version, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", err
+	}
+	v, err := extractSemVer(string(version))
+	if err != nil {
+		return "", err
+	}
+	return v.String(), nil
+}
+
+// readActive returns the recorded active version of every bundle.
+func readActive() (map[string]string, error) {
+	active := make(map[string]string)
+	b, err := os.ReadFile(filepath.Join(destination, activeFilename))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return active, nil
+		}
+		return nil, err
+	}
+	err = json.Unmarshal(b, &active)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %v: %w", activeFilename, err)
+	}
+	return active, nil
+}
+
+// writeActive writes the active versions, with the provided version as the
+// installed version of the provided bundle, to filename.
+func writeActive(filename, bundle, version string) error {
+	active, err := readActive()
+	if err != nil {
+		return err
+	}
+	active[bundle] = version
+	b, err := json.MarshalIndent(active, "", "  ")
+	if err != nil {
+		return err
+	}
+	log.Printf("Active %v version: %v", bundle, version)
+	return os.WriteFile(filename, b, 0600)
+}
+
+// printRollbackVersions prints the versions of every bundle that are
+// available for rollback. The active version is marked with a '*'.
+func printRollbackVersions() error {
+	for _, b := range bundles {
+		versions, err := b.versions()
+		if err != nil {
+			return err
+		}
+		active := b.activeVersion()
+
+		fmt.Printf("%v:\n", b.Name)
+		if len(versions) == 0 {
+			fmt.Printf("  no versions available\n")
+		}
+		for _, v := range versions {
+			mark := " "
+			if v == active {
+				mark = "*"
+			}
+			fmt.Printf(" %v %v\n", mark, v)
+		}
+	}
+	return nil
+}
+
+// rollback reinstalls a previously extracted bundle version into the
+// destination directory. Without arguments it lists the available versions.
+func rollback(args []string) error {
+	log.Printf("=== dcrinstall rollback start ===")
+
+	// Restore binaries of an interrupted installation.
+	err := recoverJournal()
+	if err != nil {
+		return fmt.Errorf("Recover interrupted installation: %v", err)
+	}
+
+	switch len(args) {
+	case 0:
+		return printRollbackVersions()
+	case 2:
+	default:
+		return fmt.Errorf("usage: rollback [<bundle> <version>]")
+	}
+
+	b, err := findBundle(args[0])
+	if err != nil {
+		return err
+	}
+	v, err := extractSemVer(args[1])
+	if err != nil {
+		return err
+	}
+	version := v.String()
+
+	dir := b.bundleDir(version)
+	if !exists(filepath.Join(destination, dir)) {
+		return fmt.Errorf("%v version %v not available, see "+
+			"'dcrinstall rollback' for available versions", b.Name,
+			version)
+	}
+	log.Printf("Rolling back %v to version: %v", b.Name, version)
+
+	// Rollback is an explicit downgrade that installs every binary of
+	// the bundle at one version and leaves the config files alone.
+	b.Version = version
+	err = b.Preconditions(b, modeRollback)
+	if err != nil {
+		return fmt.Errorf("Pre %v rollback: %v", b.Name, err)
+	}
+
+	err = installBinaries(b, version)
+	if err != nil {
+		return fmt.Errorf("%v rollback: %v", b.Name, err)
+	}
+
+	log.Printf("=== dcrinstall rollback complete ===")
+
+	return nil
+}
@@ -8,10 +8,17 @@ import (
 	"fmt"
 	"regexp"
 	"strconv"
+	"strings"
 )
 
 var relRE = regexp.MustCompile(`(v|release-v)?(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)(-(0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*)(\.(0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*))*)?(\+[0-9a-zA-Z-]+(\.[0-9a-zA-Z-]+)*)?`)
 
+// semVerSuffixes are file extensions and name suffixes that are stripped
+// before a version is extracted from a filename. The pre-release part of
+// relRE would otherwise take them for identifiers.
+var semVerSuffixes = []string{"-manifest.txt", "-manifest", ".tar.gz",
+	".tar.xz", ".tar.zst", ".tgz", ".tar", ".zip", ".exe"}
+
 type semVerInfo struct {
 	Major      uint32
 	Minor      uint32
@@ -22,7 +29,14 @@ type semVerInfo struct {
 
 // extractSemVer peels a semver out of a string.
 func extractSemVer(s string) (*semVerInfo, error) {
-	matches := relRE.FindStringSubmatch(s)
+	trimmed := s
+	for _, suffix := range semVerSuffixes {
+		if strings.HasSuffix(trimmed, suffix) {
+			trimmed = strings.TrimSuffix(trimmed, suffix)
+			break
+		}
+	}
+	matches := relRE.FindStringSubmatch(trimmed)
 	if len(matches) == 0 {
 		return nil, fmt.Errorf("version string %q does not follow semantic "+
 			"versioning requirements", s)
@@ -45,7 +59,7 @@ func extractSemVer(s string) (*semVerInfo, error) {
 		Major:      uint32(major),
 		Minor:      uint32(minor),
 		Patch:      uint32(patch),
-		PreRelease: matches[6],
+		PreRelease: strings.TrimPrefix(matches[5], "-"),
 		Build:      matches[9],
 	}, nil
 }
@@ -58,3 +72,92 @@ func (s semVerInfo) String() string {
 	}
 	return fmt.Sprintf("v%v.%v.%v%v", s.Major, s.Minor, s.Patch, pre)
 }
+
+// compare returns -1, 0 or 1 when s has a lower, equal or higher precedence
+// than o as defined by semantic versioning 2.0. Build metadata is ignored.
+func (s semVerInfo) compare(o semVerInfo) int {
+	switch {
+	case s.Major != o.Major:
+		return compareUint(s.Major, o.Major)
+	case s.Minor != o.Minor:
+		return compareUint(s.Minor, o.Minor)
+	case s.Patch != o.Patch:
+		return compareUint(s.Patch, o.Patch)
+	}
+	return comparePreRelease(s.PreRelease, o.PreRelease)
+}
+
+// compareUint returns -1, 0 or 1 when a is less than, equal to or greater
+// than b.
+func compareUint(a, b uint32) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// comparePreRelease compares two pre-release versions. A version without a
+// pre-release has a higher precedence than one with a pre-release.
+// Identifiers are compared from left to right: numeric identifiers
+// numerically and lower than alphanumeric ones, alphanumeric identifiers
+// lexically in ASCII order. A larger set of identifiers has a higher
+// precedence when all preceding identifiers are equal.
+func comparePreRelease(a, b string) int {
+	switch {
+	case a == b:
+		return 0
+	case a == "":
+		return 1
+	case b == "":
+		return -1
+	}
+
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for k := 0; k < len(as) && k < len(bs); k++ {
+		an, aErr := strconv.ParseUint(as[k], 10, 64)
+		bn, bErr := strconv.ParseUint(bs[k], 10, 64)
+		aNum, bNum := aErr == nil, bErr == nil
+		switch {
+		case aNum && bNum:
+			if an != bn {
+				if an < bn {
+					return -1
+				}
+				return 1
+			}
+		case aNum:
+			return -1
+		case bNum:
+			return 1
+		case as[k] != bs[k]:
+			if as[k] < bs[k] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case len(as) < len(bs):
+		return -1
+	case len(as) > len(bs):
+		return 1
+	}
+	return 0
+}
+
+// compareSemVer parses and compares two version strings. See
+// semVerInfo.compare for the result.
+func compareSemVer(a, b string) (int, error) {
+	av, err := extractSemVer(a)
+	if err != nil {
+		return 0, err
+	}
+	bv, err := extractSemVer(b)
+	if err != nil {
+		return 0, err
+	}
+	return av.compare(*bv), nil
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2022 The Decred developers
+// Use of this source code is governed by an ISC license that can be found in
+// the LICENSE file.
+
+package main
+
+import "testing"
+
+// TestExtractSemVer ensures versions are extracted from filenames, directory
+// names and --version output.
+func TestExtractSemVer(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"tarball", "decred-linux-amd64-v2.1.0.tar.gz", "v2.1.0"},
+		{"rc tarball", "decred-linux-amd64-v2.1.0-rc1.tar.gz", "v2.1.0-rc1"},
+		{"rc zip", "decred-windows-amd64-v2.1.0-rc1.zip", "v2.1.0-rc1"},
+		{"rc xz", "decred-linux-arm64-v2.2.0-rc1.tar.xz", "v2.2.0-rc1"},
+		{"rc zstd", "decred-linux-arm64-v2.2.0-rc1.tar.zst", "v2.2.0-rc1"},
+		{"exe", "dcrinstall-windows-amd64-v2.1.0-rc2.exe", "v2.1.0-rc2"},
+		{"multi digit", "decred-linux-amd64-v2.10.12.tar.gz", "v2.10.12"},
+		{"dotted pre-release", "decred-v1.0.0-alpha.1", "v1.0.0-alpha.1"},
+		{"directory", "decred-linux-amd64-v2.1.0-rc1", "v2.1.0-rc1"},
+		{"manifest", "decred-v2.1.0-rc1-manifest", "v2.1.0-rc1"},
+		{"manifest file", "decred-v2.1.0-rc1-manifest.txt", "v2.1.0-rc1"},
+		{"release manifest", "decred-v2.1.0-manifest.txt", "v2.1.0"},
+		{"version output", "dcrd version 2.1.0+release (Go version go1.21.5 " +
+			"linux/amd64)", "v2.1.0"},
+		{"rc version output", "dcrwallet version 2.1.0-rc1+release (Go " +
+			"version go1.21.5 linux/amd64)\n", "v2.1.0-rc1"},
+		{"release prefix", "release-v1.7.0", "v1.7.0"},
+	}
+	for _, test := range tests {
+		v, err := extractSemVer(test.in)
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", test.name, err)
+			continue
+		}
+		if got := v.String(); got != test.want {
+			t.Errorf("%v: got %v, want %v", test.name, got, test.want)
+		}
+	}
+
+	if _, err := extractSemVer("dcrd version unknown"); err == nil {
+		t.Errorf("no version: expected error")
+	}
+}
+
+// TestSemVerCompare ensures versions are ordered by semantic versioning 2.0
+// precedence.
+func TestSemVerCompare(t *testing.T) {
+	// Every version has a lower precedence than the next one.
+	ordered := []string{
+		"v1.0.0-alpha",
+		"v1.0.0-alpha.1",
+		"v1.0.0-alpha.beta",
+		"v1.0.0-beta",
+		"v1.0.0-beta.2",
+		"v1.0.0-beta.11",
+		"v1.0.0-rc.1",
+		"v1.0.0",
+		"v1.0.1",
+		"v1.9.0",
+		"v1.10.0",
+		"v2.0.0-rc1",
+		"v2.0.0-rc2",
+		"v2.0.0",
+	}
+	for i := range ordered {
+		for j := range ordered {
+			want := 0
+			switch {
+			case i < j:
+				want = -1
+			case i > j:
+				want = 1
+			}
+			got, err := compareSemVer(ordered[i], ordered[j])
+			if err != nil {
+				t.Fatalf("compare %v %v: %v", ordered[i],
+					ordered[j], err)
+			}
+			if got != want {
+				t.Errorf("compare %v %v: got %v, want %v",
+					ordered[i], ordered[j], got, want)
+			}
+		}
+	}
+
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"v1.0.0+build.1", "v1.0.0+build.2", 0},
+		{"decred-linux-amd64-v2.1.0-rc1.tar.gz", "v2.1.0", -1},
+		{"dcrd version 2.10.0+release (Go)", "v2.9.0", 1},
+	}
+	for _, test := range tests {
+		got, err := compareSemVer(test.a, test.b)
+		if err != nil {
+			t.Fatalf("compare %v %v: %v", test.a, test.b, err)
+		}
+		if got != test.want {
+			t.Errorf("compare %v %v: got %v, want %v", test.a,
+				test.b, got, test.want)
+		}
+	}
+}
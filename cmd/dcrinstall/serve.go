@@ -0,0 +1,283 @@
+// Copyright (c) 2022 The Decred developers
+// Use of this source code is governed by an ISC license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// mirrorSnapshot is a verified release in a mirror directory.
+type mirrorSnapshot struct {
+	stamp        string          // Modification stamp of the latest manifests
+	verified     time.Time       // Time of verification
+	latest       []byte          // Rewritten latest manifest
+	latestSigned []byte          // Signed upstream latest manifest
+	keys         []byte          // Key transition statements, if any
+	files        map[string]bool // Verified files that are served from disk
+}
+
+// latestStamp returns a string that changes whenever one of the latest
+// manifests in dir is replaced.
+func latestStamp(dir, latestName string) (string, error) {
+	var stamp string
+	for _, name := range []string{latestName, latestName + signedSuffix} {
+		fi, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			return "", err
+		}
+		stamp += fmt.Sprintf("%v:%v:%v ", name, fi.Size(),
+			fi.ModTime().UnixNano())
+	}
+	return stamp, nil
+}
+
+// verifyMirror verifies the signed latest manifest in dir, that the
+// rewritten latest manifest matches it, the manifests and their signatures
+// and the digest of every file listed in the manifests. It returns the
+// verified release.
+func verifyMirror(dir, latestName string) (*mirrorSnapshot, error) {
+	stamp, err := latestStamp(dir, latestName)
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify copies of the latest manifests so that what is served is
+	// what was verified, even when the mirror is updated concurrently.
+	tmp, err := scratchDir()
+	if err != nil {
+		return nil, err
+	}
+	defer removeScratchDir(tmp)
+
+	latest := filepath.Join(tmp, latestName)
+	signed := latest + signedSuffix
+	err = copyFile(latest, filepath.Join(dir, latestName))
+	if err != nil {
+		return nil, err
+	}
+	err = copyFile(signed, filepath.Join(dir, latestName+signedSuffix))
+	if err != nil {
+		return nil, err
+	}
+	var keys []byte
+	if !skipPGP {
+		// The key transition statements, if any, may introduce the
+		// key that signed the release.
+		keysFilename := filepath.Join(dir, latestName+transitionSuffix)
+		if exists(keysFilename) {
+			keys, err = os.ReadFile(keysFilename)
+			if err != nil {
+				return nil, err
+			}
+			err = loadTransitions(keys, keysFilename)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		err = pgpVerifyAttached(signed)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = matchLatest(latest, signed)
+	if err != nil {
+		return nil, err
+	}
+
+	s := mirrorSnapshot{
+		stamp:    stamp,
+		verified: time.Now(),
+		keys:     keys,
+		files:    make(map[string]bool),
+	}
+	s.latest, err = os.ReadFile(latest)
+	if err != nil {
+		return nil, err
+	}
+	s.latestSigned, err = os.ReadFile(signed)
+	if err != nil {
+		return nil, err
+	}
+
+	latestSigned, err := readLatest(signed)
+	if err != nil {
+		return nil, err
+	}
+	latestSigned.warn()
+	for _, e := range latestSigned.Entries {
+		name := path.Base(e.URI)
+		filename := filepath.Join(dir, name)
+		err = sha256Verify(filename, e.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", name, err)
+		}
+		s.files[name] = true
+
+		if !skipPGP {
+			err = pgpVerify(filename+".asc", filename)
+			if err != nil {
+				return nil, fmt.Errorf("%v: %v", name, err)
+			}
+			s.files[name+".asc"] = true
+		}
+
+		manifest, err := readManifest(filename)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range manifest {
+			name := path.Base(m.Name)
+			err = sha256Verify(filepath.Join(dir, name), m.Digest)
+			if err != nil {
+				return nil, fmt.Errorf("%v: %v", name, err)
+			}
+			s.files[name] = true
+		}
+	}
+
+	return &s, nil
+}
+
+// mirrorServer serves the most recently verified release of a mirror
+// directory.
+type mirrorServer struct {
+	dir        string
+	latestName string
+
+	mtx         sync.RWMutex
+	snapshot    *mirrorSnapshot
+	failedStamp string // Stamp of the last release that failed to verify
+}
+
+// reload verifies and publishes the release in the mirror directory when
+// the latest manifests changed. A release that is still being staged or that
+// fails verification is not published and the previously verified release
+// continues to be served.
+func (ms *mirrorServer) reload() error {
+	stamp, err := latestStamp(ms.dir, ms.latestName)
+	if err != nil {
+		return err
+	}
+
+	ms.mtx.RLock()
+	current, failedStamp := ms.snapshot, ms.failedStamp
+	ms.mtx.RUnlock()
+	if (current != nil && current.stamp == stamp) || failedStamp == stamp {
+		return nil
+	}
+
+	log.Printf("Verifying mirror: %v", ms.dir)
+	s, err := verifyMirror(ms.dir, ms.latestName)
+	if err != nil {
+		ms.mtx.Lock()
+		ms.failedStamp = stamp
+		ms.mtx.Unlock()
+		return fmt.Errorf("Mirror not published: %v", err)
+	}
+
+	ms.mtx.Lock()
+	ms.snapshot = s
+	ms.mtx.Unlock()
+	log.Printf("Mirror published: %v files", len(s.files)+2)
+
+	return nil
+}
+
+// ServeHTTP serves the files of the published release by name. Anything
+// else, including files that are being staged, is not found.
+func (ms *mirrorServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ms.mtx.RLock()
+	s := ms.snapshot
+	ms.mtx.RUnlock()
+
+	name := path.Base(r.URL.Path)
+	log.Printf("%v %v %v", r.RemoteAddr, r.Method, r.URL.Path)
+	switch {
+	case name == ms.latestName:
+		http.ServeContent(w, r, name, s.verified,
+			bytes.NewReader(s.latest))
+	case name == ms.latestName+signedSuffix:
+		http.ServeContent(w, r, name, s.verified,
+			bytes.NewReader(s.latestSigned))
+	case name == ms.latestName+transitionSuffix && s.keys != nil:
+		http.ServeContent(w, r, name, s.verified,
+			bytes.NewReader(s.keys))
+	case s.files[name]:
+		f, err := os.Open(filepath.Join(ms.dir, name))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		defer f.Close()
+		fi, err := f.Stat()
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeContent(w, r, name, fi.ModTime(), f)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serve serves a mirror directory created by the mirror command over HTTP.
+// Only a release that verified in full is served and the directory is
+// periodically checked for a new release.
+func serve(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	listenF := fs.String("listen", ":8080", "Address to listen on")
+	intervalF := fs.Duration("interval", time.Minute, "Interval to "+
+		"check the mirror directory for a new release")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: serve [-listen <address>] " +
+			"[-interval <duration>] <dir>")
+	}
+	if latestManifestURI == "" {
+		return fmt.Errorf("serve requires a latest manifest")
+	}
+
+	dir, err := filepath.Abs(cleanAndExpandPath(fs.Arg(0)))
+	if err != nil {
+		return err
+	}
+	ms := &mirrorServer{
+		dir:        dir,
+		latestName: path.Base(latestManifestURI),
+	}
+
+	log.Printf("=== dcrinstall serve start ===")
+	err = ms.reload()
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(*intervalF)
+		defer ticker.Stop()
+		for range ticker.C {
+			err := ms.reload()
+			if err != nil {
+				log.Printf("%v", err)
+			}
+		}
+	}()
+
+	log.Printf("Serving %v on %v", dir, *listenF)
+	return http.ListenAndServe(*listenF, ms)
+}
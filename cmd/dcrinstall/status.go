@@ -0,0 +1,229 @@
+// Copyright (c) 2022 The Decred developers
+// Use of this source code is governed by an ISC license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+)
+
+// fileStatus is the installation state of a single bundle file.
+type fileStatus struct {
+	Name         string `json:"name"`
+	Binary       string `json:"binary"`
+	Installed    bool   `json:"installed"`
+	Version      string `json:"version,omitempty"`
+	Config       string `json:"config,omitempty"`
+	ConfigExists bool   `json:"configexists"`
+}
+
+// bundleStatus is the installation state of a bundle.
+type bundleStatus struct {
+	Name   string       `json:"name"`
+	Active string       `json:"active,omitempty"` // Recorded active version
+	Latest string       `json:"latest,omitempty"` // Version in latest manifest
+	Files  []fileStatus `json:"files"`
+}
+
+// pathStatus records whether a path exists.
+type pathStatus struct {
+	Path   string `json:"path"`
+	Exists bool   `json:"exists"`
+}
+
+// statusReport is the inventory of an installation.
+type statusReport struct {
+	Destination string         `json:"destination"`
+	Network     string         `json:"network"`
+	Tuple       string         `json:"tuple"`
+	Bundles     []bundleStatus `json:"bundles"`
+	Certs       []pathStatus   `json:"certs"`
+	Wallets     []pathStatus   `json:"wallets"`
+}
+
+// latestState returns a human readable comparison of the installed and
+// latest version.
+func latestState(installed, latest string) string {
+	switch {
+	case latest == "":
+		return "unknown"
+	case installed == "":
+		return "not installed"
+	case installed == latest:
+		return "up to date"
+	}
+	c, err := compareSemVer(installed, latest)
+	switch {
+	case err != nil:
+		return "differs from latest " + latest
+	case c < 0:
+		return "update available " + latest
+	case c > 0:
+		return "newer than latest " + latest
+	}
+	return "up to date"
+}
+
+// inventory collects the installation state of every bundle file, the
+// client certificates and the wallet databases. Version probing is skipped
+// for foreign OS-Arch tuples since those binaries can't be executed.
+func inventory() *statusReport {
+	r := statusReport{
+		Destination: destination,
+		Network:     network,
+		Tuple:       tuple,
+	}
+
+	active, err := readActive()
+	if err != nil {
+		log.Printf("Read active versions: %v", err)
+	}
+	for _, b := range bundles {
+		bs := bundleStatus{
+			Name:   b.Name,
+			Active: active[b.Name],
+			Latest: b.Version,
+		}
+		if bs.Latest == "" {
+			bs.Latest = b.LatestVersion
+		}
+		for _, f := range b.Files {
+			fs := fileStatus{
+				Name:   f.Name,
+				Binary: binaryPath(f),
+			}
+			fs.Installed = exists(fs.Binary)
+			if fs.Installed && f.SupportsVersion &&
+				runtimeTuple() == tuple {
+
+				fs.Version, _ = binaryVersion(fs.Binary)
+			}
+			if f.Config != "" {
+				fs.Config = configPath(f.Config)
+				fs.ConfigExists = exists(fs.Config)
+			}
+			bs.Files = append(bs.Files, fs)
+		}
+		r.Bundles = append(r.Bundles, bs)
+	}
+
+	for _, v := range clientCertPaths() {
+		r.Certs = append(r.Certs, pathStatus{Path: v, Exists: exists(v)})
+	}
+	for _, v := range []string{walletDBPath(network),
+		lnWalletDBPath(network)} {
+
+		r.Wallets = append(r.Wallets, pathStatus{Path: v,
+			Exists: exists(v)})
+	}
+
+	return &r
+}
+
+// yesNo returns "yes" or "no".
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+// print prints the report as human readable tables.
+func (r *statusReport) print() {
+	fmt.Printf("Destination: %v\n", r.Destination)
+	fmt.Printf("Network:     %v\n", r.Network)
+	fmt.Printf("Tuple:       %v\n", r.Tuple)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	for _, b := range r.Bundles {
+		fmt.Fprintf(w, "\n%v (active: %v, latest: %v)\n", b.Name,
+			valueOr(b.Active, "unknown"), valueOr(b.Latest, "unknown"))
+		fmt.Fprintf(w, "NAME\tVERSION\tLATEST\tBINARY\tCONFIG\tCONFIG "+
+			"EXISTS\n")
+		for _, f := range b.Files {
+			version := f.Version
+			if version == "" {
+				version = "-"
+				if !f.Installed {
+					version = "not installed"
+				}
+			}
+			latest := "-"
+			if f.Version != "" || !f.Installed {
+				latest = latestState(f.Version, b.Latest)
+			}
+			config, configExists := "-", "-"
+			if f.Config != "" {
+				config = f.Config
+				configExists = yesNo(f.ConfigExists)
+			}
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\n", f.Name,
+				version, latest, f.Binary, config, configExists)
+		}
+	}
+	w.Flush()
+
+	for _, c := range []struct {
+		name  string
+		paths []pathStatus
+	}{
+		{"Client certificates", r.Certs},
+		{"Wallet databases", r.Wallets},
+	} {
+		fmt.Printf("\n%v:\n", c.name)
+		for _, v := range c.paths {
+			fmt.Fprintf(w, "  %v\t%v\n", v.Path, yesNo(v.Exists))
+		}
+		w.Flush()
+	}
+}
+
+// valueOr returns s or def when s is empty.
+func valueOr(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
+
+// status prints the installation inventory either as human readable tables
+// or as JSON.
+func status(args []string) error {
+	fs := flag.NewFlagSet("status", flag.ContinueOnError)
+	jsonF := fs.Bool("json", false, "Print status as JSON")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+
+	// Don't let download progress interfere with the JSON output.
+	if *jsonF {
+		quiet = true
+	}
+	err = resolveManifests()
+	if err != nil {
+		log.Printf("Latest manifest not available: %v", err)
+	}
+
+	r := inventory()
+	if !*jsonF {
+		r.print()
+		return nil
+	}
+
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", b)
+	return nil
+}
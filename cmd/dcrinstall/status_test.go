@@ -0,0 +1,34 @@
+// Copyright (c) 2022 The Decred developers
+// Use of this source code is governed by an ISC license that can be found in
+// the LICENSE file.
+
+package main
+
+import "testing"
+
+// TestInventoryLatest ensures the latest version of a bundle is the version
+// found in its manifest and otherwise the version the latest manifest lists.
+func TestInventoryLatest(t *testing.T) {
+	oldDestination := destination
+	oldDecred, oldDcrdex := *decredBundle, *dcrdexBundle
+	t.Cleanup(func() {
+		destination = oldDestination
+		*decredBundle, *dcrdexBundle = oldDecred, oldDcrdex
+	})
+	destination = t.TempDir()
+
+	decredBundle.Version = ""
+	decredBundle.LatestVersion = "v2.1.0"
+	decredBundle.ManifestURI = "https://example.org/decred-v2.0.0-" +
+		"manifest.txt"
+	dcrdexBundle.Version = "v1.0.7"
+	dcrdexBundle.LatestVersion = "v1.0.6"
+
+	want := map[string]string{"decred": "v2.1.0", "dcrdex": "v1.0.7"}
+	for _, bs := range inventory().Bundles {
+		if bs.Latest != want[bs.Name] {
+			t.Errorf("%v: got latest %q, want %q", bs.Name,
+				bs.Latest, want[bs.Name])
+		}
+	}
+}
@@ -0,0 +1,521 @@
+// Copyright (c) 2022 The Decred developers
+// Use of this source code is governed by an ISC license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/clearsign"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+const (
+	// transitionSuffix is appended to the name of the latest manifest to
+	// name the file with the key transition statements that is published
+	// next to it.
+	transitionSuffix = ".keys"
+
+	// transitionHeader is the first line of a key transition statement.
+	transitionHeader = "dcrinstall key transition"
+
+	// transitionNewKey prefixes the fingerprint of the key that a key
+	// transition statement introduces.
+	transitionNewKey = "New key: "
+)
+
+var (
+	// errKeyRevoked is returned for signatures by a revoked key.
+	errKeyRevoked = errors.New("signing key is revoked")
+
+	// errKeyExpired is returned for signatures by an expired key.
+	errKeyExpired = errors.New("signing key is expired")
+
+	// errWeakHash is returned for signatures that use a weak hash
+	// algorithm.
+	errWeakHash = errors.New("signature uses a weak hash algorithm")
+
+	// strongHashes are the hash algorithms that signatures may use.
+	strongHashes = map[crypto.Hash]bool{
+		crypto.SHA256: true,
+		crypto.SHA384: true,
+		crypto.SHA512: true,
+	}
+)
+
+// unknownKeyError is returned for signatures by a key that is not trusted.
+type unknownKeyError struct {
+	keyID uint64
+}
+
+// Error satisfies the error interface for unknownKeyError.
+func (e unknownKeyError) Error() string {
+	return fmt.Sprintf("signed by unknown key %016X", e.keyID)
+}
+
+// trustRoots are the keys that are trusted to sign releases. They are loaded
+// on first use from the built-in keys and the keyring file, if any, and may
+// grow by key transition statements.
+var trustRoots struct {
+	sync.Mutex
+	loaded bool
+	keys   openpgp.EntityList
+}
+
+// fingerprint returns the fingerprint of the provided key.
+func fingerprint(pk *packet.PublicKey) string {
+	return fmt.Sprintf("%X", pk.Fingerprint)
+}
+
+// keyName returns the fingerprint and primary identity of the provided
+// entity.
+func keyName(e *openpgp.Entity) string {
+	for name, ident := range e.Identities {
+		sig := ident.SelfSignature
+		if sig != nil && sig.IsPrimaryId != nil && *sig.IsPrimaryId {
+			return fingerprint(e.PrimaryKey) + " (" + name + ")"
+		}
+	}
+	for name := range e.Identities {
+		return fingerprint(e.PrimaryKey) + " (" + name + ")"
+	}
+	return fingerprint(e.PrimaryKey)
+}
+
+// trustKeys adds the provided keys to the trust roots. The caller must hold
+// the trust roots lock.
+func trustKeys(el openpgp.EntityList, source string) {
+	for _, e := range el {
+		log.Printf("Trusted key from %v: %v", source, keyName(e))
+		trustRoots.keys = append(trustRoots.keys, e)
+	}
+}
+
+// readArmoredKeys returns the keys in the armored public key block.
+func readArmoredKeys(block []byte) (openpgp.EntityList, error) {
+	el, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(block))
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range el {
+		if e.PrivateKey != nil {
+			return nil, fmt.Errorf("private key in keyring: %v",
+				keyName(e))
+		}
+	}
+	return el, nil
+}
+
+// armoredBlocks splits data into its armored public key blocks and its clear
+// signed messages. Anything in between is ignored.
+func armoredBlocks(data []byte) ([][]byte, [][]byte, error) {
+	var keys, signed [][]byte
+	var block []byte
+	var end string
+	for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+		l := strings.TrimSpace(string(line))
+		if end == "" {
+			switch l {
+			case "-----BEGIN PGP PUBLIC KEY BLOCK-----":
+				end = "-----END PGP PUBLIC KEY BLOCK-----"
+			case "-----BEGIN PGP SIGNED MESSAGE-----":
+				end = "-----END PGP SIGNATURE-----"
+			default:
+				continue
+			}
+			block = nil
+		}
+
+		block = append(block, line...)
+		if l != end {
+			continue
+		}
+		if strings.Contains(end, "KEY") {
+			keys = append(keys, block)
+		} else {
+			signed = append(signed, block)
+		}
+		end = ""
+	}
+	if end != "" {
+		return nil, nil, fmt.Errorf("unterminated armored block")
+	}
+
+	return keys, signed, nil
+}
+
+// loadTrustRoots loads the built-in keys and the keys and key transition
+// statements of the keyring file. The caller must hold the trust roots lock.
+func loadTrustRoots() error {
+	trustRoots.keys = nil
+	for _, key := range builtinPubkeys {
+		el, err := readArmoredKeys([]byte(key))
+		if err != nil {
+			return fmt.Errorf("Built-in key: %v", err)
+		}
+		trustKeys(el, "built-in keyring")
+	}
+	if keyringFile == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(keyringFile)
+	if err != nil {
+		return fmt.Errorf("Keyring: %v", err)
+	}
+	keys, statements, err := armoredBlocks(data)
+	if err != nil {
+		return fmt.Errorf("Keyring %v: %v", keyringFile, err)
+	}
+	if len(keys) == 0 && len(statements) == 0 {
+		return fmt.Errorf("Keyring %v: no keys", keyringFile)
+	}
+	for _, block := range keys {
+		el, err := readArmoredKeys(block)
+		if err != nil {
+			return fmt.Errorf("Keyring %v: %v", keyringFile, err)
+		}
+		trustKeys(el, keyringFile)
+	}
+	err = addTransitions(statements, keyringFile)
+	if err != nil {
+		return fmt.Errorf("Keyring %v: %v", keyringFile, err)
+	}
+
+	return nil
+}
+
+// trustedKeys returns the trust roots, loading them on first use.
+func trustedKeys() (openpgp.EntityList, error) {
+	trustRoots.Lock()
+	defer trustRoots.Unlock()
+
+	if !trustRoots.loaded {
+		err := loadTrustRoots()
+		if err != nil {
+			return nil, err
+		}
+		trustRoots.loaded = true
+	}
+	return append(openpgp.EntityList(nil), trustRoots.keys...), nil
+}
+
+// keyExpired returns true if the key expired according to its self
+// signature. The lifetime of a key counts from the creation of the key.
+func keyExpired(pk *packet.PublicKey, sig *packet.Signature,
+	now time.Time) bool {
+
+	if sig == nil || sig.KeyLifetimeSecs == nil ||
+		*sig.KeyLifetimeSecs == 0 {
+
+		return false
+	}
+	lifetime := time.Duration(*sig.KeyLifetimeSecs) * time.Second
+	return now.After(pk.CreationTime.Add(lifetime))
+}
+
+// checkKey returns an error if the provided key, or the primary key it
+// belongs to, is revoked or expired.
+func checkKey(k openpgp.Key, now time.Time) error {
+	e := k.Entity
+	if len(e.Revocations) > 0 {
+		return fmt.Errorf("%w: %v", errKeyRevoked, keyName(e))
+	}
+	if k.SelfSignature != nil &&
+		(k.SelfSignature.RevocationReason != nil ||
+			k.SelfSignature.SigType == packet.SigTypeSubkeyRevocation) {
+
+		return fmt.Errorf("%w: %v", errKeyRevoked,
+			fingerprint(k.PublicKey))
+	}
+
+	// The primary key expires when all its identities expired.
+	expired := len(e.Identities) > 0
+	for _, ident := range e.Identities {
+		if !keyExpired(e.PrimaryKey, ident.SelfSignature, now) {
+			expired = false
+		}
+	}
+	if expired {
+		return fmt.Errorf("%w: %v", errKeyExpired, keyName(e))
+	}
+	if k.PublicKey != e.PrimaryKey &&
+		keyExpired(k.PublicKey, k.SelfSignature, now) {
+
+		return fmt.Errorf("%w: %v", errKeyExpired,
+			fingerprint(k.PublicKey))
+	}
+
+	return nil
+}
+
+// verifyTrusted verifies the binary OpenPGP signature sig of signed with the
+// provided trusted keys and returns the key that made it. Signatures by
+// unknown, revoked or expired keys are rejected.
+func verifyTrusted(keyring openpgp.EntityList, signed io.Reader,
+	sig []byte) (*openpgp.Key, error) {
+
+	p, err := packet.Read(bytes.NewReader(sig))
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature: %v", err)
+	}
+	var keyID uint64
+	var hashFunc crypto.Hash
+	switch s := p.(type) {
+	case *packet.Signature:
+		if s.IssuerKeyId == nil {
+			return nil, fmt.Errorf("signature has no issuer")
+		}
+		keyID = *s.IssuerKeyId
+		hashFunc = s.Hash
+	case *packet.SignatureV3:
+		keyID = s.IssuerKeyId
+		hashFunc = s.Hash
+	default:
+		return nil, fmt.Errorf("not a signature")
+	}
+	if !strongHashes[hashFunc] {
+		return nil, fmt.Errorf("%w: %v", errWeakHash, hashFunc)
+	}
+
+	keys := keyring.KeysById(keyID)
+	if len(keys) == 0 {
+		return nil, unknownKeyError{keyID: keyID}
+	}
+
+	// The same key may be trusted more than once, for example with a
+	// revocation from the keyring file. Reject it if any copy is revoked
+	// or expired.
+	now := time.Now()
+	for _, k := range keys {
+		err = checkKey(k, now)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	k := keys[0]
+	_, err = openpgp.CheckDetachedSignature(openpgp.EntityList{k.Entity},
+		signed, bytes.NewReader(sig))
+	if err != nil {
+		return nil, err
+	}
+	if k.PublicKey != k.Entity.PrimaryKey {
+		log.Printf("Signed by subkey %v of key %v",
+			fingerprint(k.PublicKey), keyName(k.Entity))
+	} else {
+		log.Printf("Signed by key %v", keyName(k.Entity))
+	}
+
+	return &k, nil
+}
+
+// decodeClearSigned decodes the clear signed message in data. Only the
+// plaintext of the message is covered by the signature so data must consist
+// of exactly one clear signed message. Anything before or after it is
+// rejected.
+func decodeClearSigned(data []byte) (*clearsign.Block, error) {
+	b, rest := clearsign.Decode(data)
+	if b == nil {
+		return nil, fmt.Errorf("not a clear signed message")
+	}
+	start := bytes.Index(data, []byte("-----BEGIN PGP SIGNED MESSAGE-----"))
+	if len(bytes.TrimSpace(data[:start])) != 0 {
+		return nil, fmt.Errorf("unsigned content before clear signed " +
+			"message")
+	}
+	rest = bytes.TrimSpace(rest)
+	if len(rest) != 0 {
+		if next, _ := clearsign.Decode(rest); next != nil {
+			return nil, fmt.Errorf("more than one clear signed " +
+				"message")
+		}
+		return nil, fmt.Errorf("unsigned content after clear signed " +
+			"message")
+	}
+
+	return b, nil
+}
+
+// verifyClearSigned verifies the clear signed message b with the provided
+// trusted keys and returns the key that signed it.
+func verifyClearSigned(keyring openpgp.EntityList,
+	b *clearsign.Block) (*openpgp.Key, error) {
+
+	sig, err := io.ReadAll(b.ArmoredSignature.Body)
+	if err != nil {
+		return nil, err
+	}
+	return verifyTrusted(keyring, bytes.NewReader(b.Bytes), sig)
+}
+
+// verifyTransition verifies a key transition statement with the provided
+// trusted keys and returns the key it introduces. A statement is a clear
+// signed message that consists of the transition header, the fingerprint of
+// the new key and the armored new key.
+func verifyTransition(keyring openpgp.EntityList,
+	statement []byte) (openpgp.EntityList, error) {
+
+	b, err := decodeClearSigned(statement)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key transition statement: %v",
+			err)
+	}
+	lines := strings.Split(string(b.Plaintext), "\n")
+	if len(lines) < 2 || strings.TrimSpace(lines[0]) != transitionHeader ||
+		!strings.HasPrefix(lines[1], transitionNewKey) {
+
+		return nil, fmt.Errorf("invalid key transition statement")
+	}
+	newKey := strings.TrimSpace(strings.TrimPrefix(lines[1],
+		transitionNewKey))
+
+	keys, _, err := armoredBlocks(b.Plaintext)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) != 1 {
+		return nil, fmt.Errorf("key transition statement for %v does "+
+			"not contain the new key", newKey)
+	}
+	el, err := readArmoredKeys(keys[0])
+	if err != nil {
+		return nil, err
+	}
+	if len(el) != 1 || !strings.EqualFold(fingerprint(el[0].PrimaryKey),
+		newKey) {
+
+		return nil, fmt.Errorf("key transition statement for %v "+
+			"contains a different key", newKey)
+	}
+
+	signer, err := verifyClearSigned(keyring, b)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Key transition from %v to %v", keyName(signer.Entity),
+		keyName(el[0]))
+
+	return el, nil
+}
+
+// addTransitions adds the keys introduced by the provided key transition
+// statements to the trust roots. Statements may be signed by keys that other
+// statements introduce. Statements by keys that are not trusted, revoked or
+// expired are skipped, any other invalid statement is an error. The caller
+// must hold the trust roots lock.
+func addTransitions(statements [][]byte, source string) error {
+	pending := statements
+	for len(pending) > 0 {
+		var skipped [][]byte
+		var errs []error
+		for _, statement := range pending {
+			el, err := verifyTransition(trustRoots.keys, statement)
+			if err != nil {
+				var uk unknownKeyError
+				if !errors.As(err, &uk) &&
+					!errors.Is(err, errKeyRevoked) &&
+					!errors.Is(err, errKeyExpired) {
+
+					return err
+				}
+				skipped = append(skipped, statement)
+				errs = append(errs, err)
+				continue
+			}
+			trustKeys(el, source)
+		}
+		if len(skipped) == len(pending) {
+			for _, err := range errs {
+				log.Printf("Skipping key transition statement: "+
+					"%v", err)
+			}
+			break
+		}
+		pending = skipped
+	}
+
+	return nil
+}
+
+// fetchTransitions downloads the key transition statements published next to
+// the latest manifest and adds the keys they introduce to the trust roots. It
+// returns the downloaded statements.
+func fetchTransitions() ([]byte, error) {
+	dir, err := scratchDir()
+	if err != nil {
+		return nil, err
+	}
+	defer removeScratchDir(dir)
+
+	filename := filepath.Join(dir, path.Base(latestManifestURI)+
+		transitionSuffix)
+	err = DownloadFile(latestManifestURI+transitionSuffix, filename)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	err = loadTransitions(data, latestManifestURI+transitionSuffix)
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// loadTransitions adds the keys introduced by the key transition statements
+// in data to the trust roots.
+func loadTransitions(data []byte, source string) error {
+	_, statements, err := armoredBlocks(data)
+	if err != nil {
+		return err
+	}
+	if len(statements) == 0 {
+		return fmt.Errorf("no key transition statements")
+	}
+
+	_, err = trustedKeys()
+	if err != nil {
+		return err
+	}
+	trustRoots.Lock()
+	defer trustRoots.Unlock()
+	return addTransitions(statements, source)
+}
+
+// verifyLatestSignature verifies the clear signed latest manifest. When it is
+// signed by an unknown key the key transition statements published next to
+// the latest manifest, which may introduce that key, are fetched and the
+// manifest is verified again.
+func verifyLatestSignature(filename string) error {
+	err := pgpVerifyAttached(filename)
+	var uk unknownKeyError
+	if !errors.As(err, &uk) {
+		return err
+	}
+
+	log.Printf("Latest manifest %v, fetching key transition statements",
+		err)
+	_, terr := fetchTransitions()
+	if terr != nil {
+		log.Printf("Key transition statements: %v", terr)
+		return err
+	}
+	return pgpVerifyAttached(filename)
+}
@@ -0,0 +1,151 @@
+// Copyright (c) 2022 The Decred developers
+// Use of this source code is governed by an ISC license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/clearsign"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// newTestEntity returns a new signing key.
+func newTestEntity(t *testing.T, name string) *openpgp.Entity {
+	t.Helper()
+
+	e, err := openpgp.NewEntity(name, "", name+"@example.org",
+		&packet.Config{RSABits: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+// clearSign returns text clear signed by e with the provided hash.
+func clearSign(t *testing.T, e *openpgp.Entity, text string,
+	hash crypto.Hash) string {
+
+	t.Helper()
+
+	var buf bytes.Buffer
+	w, err := clearsign.Encode(&buf, e.PrivateKey,
+		&packet.Config{DefaultHash: hash})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte(text)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+// TestDecodeClearSigned ensures only data that consists of exactly one clear
+// signed message is accepted.
+func TestDecodeClearSigned(t *testing.T) {
+	e := newTestEntity(t, "release")
+	signed := clearSign(t, e, "signed\n", crypto.SHA256)
+
+	tests := []struct {
+		name string
+		data string
+		err  string
+	}{
+		{"signed", signed, ""},
+		{"surrounding whitespace", "\n \n" + signed + "\n\n", ""},
+		{"not signed", "signed\n", "not a clear signed message"},
+		{"leading text", "unsigned\n" + signed,
+			"unsigned content before clear signed message"},
+		{"trailing text", signed + "unsigned\n",
+			"unsigned content after clear signed message"},
+		{"two messages", signed + signed,
+			"more than one clear signed message"},
+	}
+	for _, test := range tests {
+		b, err := decodeClearSigned([]byte(test.data))
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%v: got error %v, want %v", test.name,
+					err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", test.name, err)
+			continue
+		}
+		if string(b.Plaintext) != "signed\n" {
+			t.Errorf("%v: got plaintext %q", test.name, b.Plaintext)
+		}
+	}
+}
+
+// TestVerifyClearSigned ensures clear signed messages are only accepted when
+// they are signed by a trusted, unrevoked key with a strong hash.
+func TestVerifyClearSigned(t *testing.T) {
+	trusted := newTestEntity(t, "release")
+	unknown := newTestEntity(t, "unknown")
+	revoked := newTestEntity(t, "revoked")
+	revoked.Revocations = append(revoked.Revocations, &packet.Signature{})
+	keyring := openpgp.EntityList{trusted, revoked}
+
+	tampered := strings.Replace(clearSign(t, trusted, "signed\n",
+		crypto.SHA256), "signed\n", "tampered\n", 1)
+
+	tests := []struct {
+		name    string
+		data    string
+		fail    bool
+		err     error // Expected error, if any specific one
+		unknown bool  // Expect an unknownKeyError
+	}{
+		{name: "trusted", data: clearSign(t, trusted, "signed\n",
+			crypto.SHA256)},
+		{name: "sha512", data: clearSign(t, trusted, "signed\n",
+			crypto.SHA512)},
+		{name: "weak hash", data: clearSign(t, trusted, "signed\n",
+			crypto.SHA1), fail: true, err: errWeakHash},
+		{name: "revoked", data: clearSign(t, revoked, "signed\n",
+			crypto.SHA256), fail: true, err: errKeyRevoked},
+		{name: "tampered", data: tampered, fail: true},
+		{name: "unknown", data: clearSign(t, unknown, "signed\n",
+			crypto.SHA256), fail: true, unknown: true},
+	}
+	for _, test := range tests {
+		b, err := decodeClearSigned([]byte(test.data))
+		if err != nil {
+			t.Fatalf("%v: %v", test.name, err)
+		}
+		k, err := verifyClearSigned(keyring, b)
+		if !test.fail {
+			if err != nil {
+				t.Errorf("%v: unexpected error: %v", test.name,
+					err)
+			} else if k.Entity != trusted {
+				t.Errorf("%v: signed by %v", test.name,
+					keyName(k.Entity))
+			}
+			continue
+		}
+		var uerr unknownKeyError
+		switch {
+		case err == nil:
+			t.Errorf("%v: expected error", test.name)
+		case test.err != nil && !errors.Is(err, test.err):
+			t.Errorf("%v: got error %v, want %v", test.name, err,
+				test.err)
+		case test.unknown && !errors.As(err, &uerr):
+			t.Errorf("%v: got error %v, want unknown key",
+				test.name, err)
+		}
+	}
+}
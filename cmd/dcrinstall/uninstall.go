@@ -0,0 +1,260 @@
+// Copyright (c) 2022 The Decred developers
+// Use of this source code is governed by an ISC license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/decred/dcrd/dcrutil/v4"
+)
+
+const (
+	// confirmWallets is what the user must type to confirm wallet removal.
+	confirmWallets = "delete my wallets"
+)
+
+// uninstallPlan lists all paths, per category, that an uninstall removes.
+type uninstallPlan struct {
+	Binaries []string
+	Configs  []string
+	Certs    []string
+	Wallets  []string
+}
+
+// configPath returns the full path of the provided config filename in its
+// application data directory.
+func configPath(config string) string {
+	ext := filepath.Ext(config)
+	name := strings.TrimSuffix(config, ext)
+	return filepath.Join(dcrutil.AppDataDir(name, false), config)
+}
+
+// binaryPath returns the full path of the provided installed file.
+func binaryPath(f decredFiles) string {
+	filename := filepath.Join(destination, f.Name)
+	// yep, this is ferrealz
+	if !f.Directory && strings.HasPrefix(tuple, "windows") {
+		filename += ".exe"
+	}
+	return filename
+}
+
+// appendExisting appends filename to list if it exists.
+func appendExisting(list []string, filename string) []string {
+	if !exists(filename) {
+		return list
+	}
+	return append(list, filename)
+}
+
+// planUninstall walks the decred and dcrdex file tables and returns every
+// existing path that belongs to the selected categories.
+func planUninstall(binaries, configs, certs, wallets bool) (*uninstallPlan,
+	error) {
+
+	var p uninstallPlan
+	for _, b := range bundles {
+		for _, f := range b.Files {
+			if binaries {
+				p.Binaries = appendExisting(p.Binaries,
+					binaryPath(f))
+			}
+			if configs && f.Config != "" {
+				p.Configs = appendExisting(p.Configs,
+					configPath(f.Config))
+			}
+		}
+
+		if !binaries {
+			continue
+		}
+		versions, err := b.versions()
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range versions {
+			p.Binaries = appendExisting(p.Binaries,
+				filepath.Join(destination, b.bundleDir(v)))
+		}
+	}
+	if binaries {
+		p.Binaries = appendExisting(p.Binaries,
+			filepath.Join(destination, activeFilename))
+	}
+
+	if certs {
+		for _, filename := range clientCertPaths() {
+			p.Certs = appendExisting(p.Certs, filename)
+		}
+	}
+
+	if wallets {
+		p.Wallets = appendExisting(p.Wallets, walletDBPath(network))
+		p.Wallets = appendExisting(p.Wallets, lnWalletDBPath(network))
+	}
+
+	return &p, nil
+}
+
+// all returns all paths in the plan.
+func (p *uninstallPlan) all() []string {
+	var all []string
+	all = append(all, p.Binaries...)
+	all = append(all, p.Configs...)
+	all = append(all, p.Certs...)
+	all = append(all, p.Wallets...)
+	return all
+}
+
+// print prints the plan.
+func (p *uninstallPlan) print() {
+	for _, c := range []struct {
+		name  string
+		paths []string
+	}{
+		{"Binaries", p.Binaries},
+		{"Configuration files", p.Configs},
+		{"Client certificates", p.Certs},
+		{"Wallet databases", p.Wallets},
+	} {
+		if len(c.paths) == 0 {
+			continue
+		}
+		fmt.Printf("%v:\n", c.name)
+		for _, v := range c.paths {
+			fmt.Printf("\t%v\n", v)
+		}
+	}
+}
+
+// prompt prints the provided question and returns the line the user
+// entered.
+func prompt(question string) (string, error) {
+	fmt.Printf("%v: ", question)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// uninstall removes a dcrinstall deployment. What is removed is opt-in per
+// category and wallet databases are only removed after an explicit
+// confirmation.
+func uninstall(args []string) error {
+	fs := flag.NewFlagSet("uninstall", flag.ContinueOnError)
+	binariesF := fs.Bool("binaries", false, "Remove installed binaries "+
+		"and retained bundle directories")
+	configsF := fs.Bool("configs", false, "Remove generated "+
+		"configuration files")
+	certsF := fs.Bool("certs", false, "Remove client certificates")
+	walletsF := fs.Bool("wallets", false, "Remove wallet databases of "+
+		"the selected network. THIS DESTROYS WALLETS")
+	confirmWalletsF := fs.Bool("confirmwallets", false, "Confirm wallet "+
+		"database removal without prompting")
+	yesF := fs.Bool("yes", false, "Don't ask for confirmation, does not "+
+		"apply to wallet databases")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+	if !*binariesF && !*configsF && !*certsF && !*walletsF {
+		fs.Usage()
+		return fmt.Errorf("nothing selected to uninstall")
+	}
+
+	log.Printf("=== dcrinstall uninstall start ===")
+
+	// Restore binaries of an interrupted installation so that the
+	// journal's leftovers don't linger.
+	err = recoverJournal()
+	if err != nil {
+		return fmt.Errorf("Recover interrupted installation: %v", err)
+	}
+
+	// Running processes hold on to their configuration files,
+	// certificates and wallet databases as well, so refuse to remove
+	// anything while they run.
+	if runtimeTuple() == tuple {
+		var isRunningList []string
+		for k := range bundles {
+			for _, f := range bundles[k].Files {
+				if f.Directory {
+					continue
+				}
+				ok, err := isRunning(f.Name)
+				if err != nil {
+					return fmt.Errorf("isRunning: %v", err)
+				}
+				if ok {
+					isRunningList = append(isRunningList,
+						f.Name)
+				}
+			}
+		}
+		if !allowRunning && len(isRunningList) > 0 {
+			return fmt.Errorf("Processes still running: %v",
+				isRunningList)
+		}
+	}
+
+	p, err := planUninstall(*binariesF, *configsF, *certsF, *walletsF)
+	if err != nil {
+		return err
+	}
+	all := p.all()
+	if len(all) == 0 {
+		log.Printf("Nothing to uninstall")
+		return nil
+	}
+
+	fmt.Printf("\nThe following will be removed:\n\n")
+	p.print()
+	fmt.Println()
+
+	if len(p.Wallets) > 0 && !*confirmWalletsF {
+		fmt.Printf("WARNING: removing wallet databases destroys the " +
+			"wallets. Make sure the seeds are backed up.\n")
+		answer, err := prompt(fmt.Sprintf("Type '%v' to remove the "+
+			"wallet databases", confirmWallets))
+		if err != nil {
+			return err
+		}
+		if answer != confirmWallets {
+			return fmt.Errorf("wallet database removal not " +
+				"confirmed, nothing removed")
+		}
+	} else if !*yesF {
+		answer, err := prompt("Proceed? (yes/no)")
+		if err != nil {
+			return err
+		}
+		if answer != "yes" {
+			return fmt.Errorf("uninstall not confirmed, nothing " +
+				"removed")
+		}
+	}
+
+	for _, v := range all {
+		log.Printf("Removing: %v", v)
+		err := os.RemoveAll(v)
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Printf("=== dcrinstall uninstall complete ===")
+
+	return nil
+}
@@ -5,28 +5,31 @@
 package main
 
 import (
-	"archive/tar"
 	"archive/zip"
 	"bufio"
-	"bytes"
-	"compress/gzip"
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"os/user"
+	"path"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/decred/dcrd/dcrutil/v4"
 	humanize "github.com/dustin/go-humanize"
 	"golang.org/x/crypto/openpgp"
-	"golang.org/x/crypto/openpgp/clearsign"
+	"golang.org/x/crypto/openpgp/armor"
 )
 
 func fileExists(name string) bool {
@@ -52,6 +55,34 @@ func copyFile(dst, src string) error {
 	return err
 }
 
+// copyFileHashed copies src to dst and returns the sha256 digest of the
+// copied data, so that a copy can be verified without reading it again.
+func copyFileHashed(dst, src string) ([]byte, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return nil, err
+	}
+	defer out.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(out, h), in)
+	if err != nil {
+		return nil, err
+	}
+	err = out.Sync()
+	if err != nil {
+		return nil, err
+	}
+
+	return h.Sum(nil), nil
+}
+
 // cleanAndExpandPath expands environment variables and leading ~ in the
 // passed path, cleans the result, and returns it.
 func cleanAndExpandPath(path string) string {
@@ -106,161 +137,577 @@ func cleanAndExpandPath(path string) string {
 	return filepath.Join(homeDir, path)
 }
 
+const (
+	// stallTimeout is how long a download may go without receiving any
+	// data before the attempt is aborted.
+	stallTimeout = 2 * time.Minute
+
+	// maxRetryBackoff caps the exponential backoff between download
+	// retries.
+	maxRetryBackoff = time.Minute
+)
+
+// downloadProgress keeps track of concurrent downloads and prints their
+// combined progress on a single line.
+type downloadProgress struct {
+	mtx    sync.Mutex
+	names  []string          // Active downloads in start order
+	totals map[string]uint64 // Bytes received by active downloads
+	width  int               // Width of the last printed line
+}
+
+var progress = downloadProgress{totals: make(map[string]uint64)}
+
+// start adds a download to the progress line.
+func (p *downloadProgress) start(name string) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if _, ok := p.totals[name]; !ok {
+		p.names = append(p.names, name)
+	}
+	p.totals[name] = 0
+}
+
+// update records the bytes received by a download and prints the progress
+// line.
+func (p *downloadProgress) update(name string, total uint64) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	p.totals[name] = total
+	p.print()
+}
+
+// done removes a download from the progress line. The line is terminated
+// once all downloads are done.
+func (p *downloadProgress) done(name string) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	delete(p.totals, name)
+	for k := range p.names {
+		if p.names[k] == name {
+			p.names = append(p.names[:k], p.names[k+1:]...)
+			break
+		}
+	}
+	if len(p.names) > 0 {
+		p.print()
+		return
+	}
+
+	// The progress use the same line so print a new line once all
+	// downloads are finished
+	if p.width > 0 {
+		fmt.Println()
+		p.width = 0
+	}
+}
+
+// print prints the progress line. It must be called with the mutex held.
+func (p *downloadProgress) print() {
+	if quiet {
+		return
+	}
+
+	// We use the humanize package to print the bytes in a meaningful way
+	// (e.g. 10 MB)
+	var line string
+	switch len(p.names) {
+	case 0:
+		return
+	case 1:
+		line = fmt.Sprintf("Downloading... %s complete",
+			humanize.Bytes(p.totals[p.names[0]]))
+	default:
+		status := make([]string, 0, len(p.names))
+		for _, name := range p.names {
+			status = append(status, fmt.Sprintf("%v %v", name,
+				humanize.Bytes(p.totals[name])))
+		}
+		line = "Downloading... " + strings.Join(status, ", ")
+	}
+
+	// Clear the line by using a character return to go back to the start
+	// and remove the remaining characters by filling it with spaces
+	fmt.Printf("\r%s\r%s", strings.Repeat(" ", p.width), line)
+	p.width = len(line)
+}
+
+// progressWriter is a writer that moves the progress line out of the way of
+// what is written to it, e.g. log messages.
+type progressWriter struct {
+	w io.Writer
+}
+
+// Write satisfies the Writer interface for progressWriter.
+func (pw progressWriter) Write(b []byte) (int, error) {
+	progress.mtx.Lock()
+	defer progress.mtx.Unlock()
+
+	if progress.width > 0 {
+		fmt.Printf("\r%s\r", strings.Repeat(" ", progress.width))
+		progress.width = 0
+		defer progress.print()
+	}
+	return pw.w.Write(b)
+}
+
 // WriteCounter keeps track of the download progress.
 type WriteCounter struct {
+	Name  string // Name shown in the progress line
 	Total uint64
+	Stall *time.Timer // Reset on every write when not nil
 }
 
 // Write satisfies the Writer interface for WriteCounter.
 func (wc *WriteCounter) Write(p []byte) (int, error) {
 	n := len(p)
 	wc.Total += uint64(n)
+	if wc.Stall != nil {
+		wc.Stall.Reset(stallTimeout)
+	}
 	wc.PrintProgress()
 	return n, nil
 }
 
 // PrintProgress prints the progress of a file write
 func (wc WriteCounter) PrintProgress() {
-	if quiet {
-		return
+	progress.update(wc.Name, wc.Total)
+}
+
+// offlinePath returns the path of the file in the offline release directory
+// that corresponds to the provided URI. All artifacts of an offline release
+// live in the same directory so only the last URI element matters.
+func offlinePath(uri string) string {
+	return filepath.Join(offlineDir, path.Base(uri))
+}
+
+// normalizeMirror validates a mirror base URL and makes sure it ends with a
+// '/'.
+func normalizeMirror(mirror string) (string, error) {
+	u, err := url.Parse(mirror)
+	if err != nil {
+		return "", err
+	}
+	switch u.Scheme {
+	case "http", "https", "file":
+	default:
+		return "", fmt.Errorf("invalid mirror URL: %v", mirror)
+	}
+	if !strings.HasSuffix(mirror, "/") {
+		mirror += "/"
 	}
+	return mirror, nil
+}
 
-	// Clear the line by using a character return to go back to the start
-	// and remove the remaining characters by filling it with spaces
-	fmt.Printf("\r%s", strings.Repeat(" ", 50))
+// parseMirrors parses a comma separated list of mirror base URLs.
+func parseMirrors(list string) ([]string, error) {
+	var mirrors []string
+	for _, m := range strings.Split(list, ",") {
+		m = strings.TrimSpace(m)
+		if m == "" {
+			continue
+		}
+		m, err := normalizeMirror(m)
+		if err != nil {
+			return nil, err
+		}
+		mirrors = append(mirrors, m)
+	}
+	return mirrors, nil
+}
 
-	// Return again and print current status of download We use the
-	// humanize package to print the bytes in a meaningful way (e.g. 10 MB)
-	fmt.Printf("\rDownloading... %s complete", humanize.Bytes(wc.Total))
+// mirrorURIs returns the URIs to try, in order, to download the provided
+// URI. Mirrors are flat so only the last URI element matters. The mirrors
+// provided by the user come first, followed by the URI itself and the
+// mirrors listed in the latest manifest. Mirrors don't need to be trusted
+// since everything is verified regardless of where it was downloaded from.
+func mirrorURIs(uri string) []string {
+	name := path.Base(uri)
+	uris := make([]string, 0, len(mirrors)+len(latestMirrors)+1)
+	seen := make(map[string]bool)
+	add := func(u string) {
+		if !seen[u] {
+			seen[u] = true
+			uris = append(uris, u)
+		}
+	}
+	for _, m := range mirrors {
+		add(m + name)
+	}
+	add(uri)
+	for _, m := range latestMirrors {
+		add(m + name)
+	}
+	return uris
 }
 
-// DownloadFile downloads the provided URL to the filepath. If the quiet flag
-// is not set it prints download progress.
+// DownloadFile downloads the provided URL to the filepath, failing over to
+// the next mirror when a download fails. If the quiet flag is not set it
+// prints download progress. In offline mode the file is copied from the
+// offline release directory instead and the network is never used.
 func DownloadFile(url string, path string) error {
-	log.Printf("Download file: %v -> %v", url, path)
+	return downloadDigest(url, path, "")
+}
 
-	// Create the file with .tmp extension, so that we won't overwrite a
-	// file until it's downloaded fully
-	out, err := os.Create(path + ".tmp")
-	if err != nil {
-		return err
+// downloadDigest downloads the provided URL to the filepath like DownloadFile.
+// The file is hashed while it is downloaded and, unless digest is empty, it is
+// only moved into place when it matches digest. A source that serves a file
+// that does not match is skipped like any other failed download.
+func downloadDigest(url, path, digest string) error {
+	if offlineDir != "" {
+		return downloadFile(url, path, digest)
 	}
-	defer out.Close()
 
-	// Deal with local files
-	if strings.HasPrefix(url, "file://") {
-		localpath := url[len("file://"):]
-		src, err := os.Open(localpath)
-		if err != nil {
-			return err
+	var err error
+	uris := mirrorURIs(url)
+	for k, u := range uris {
+		err = downloadFile(u, path, digest)
+		if err == nil {
+			return nil
 		}
-		defer src.Close()
+		log.Printf("Download failed: %v: %v", u, err)
 
-		_, err = io.Copy(out, src)
-		if err != nil {
-			return err
+		// Don't resume a partial download from another mirror. The
+		// partial download of the last source is kept so that it can
+		// be resumed.
+		if k != len(uris)-1 {
+			os.Remove(path + ".tmp")
 		}
+	}
+	return err
+}
+
+// downloadFile downloads the provided URL to the filepath and verifies it
+// against digest when it is not empty.
+func downloadFile(url, path, digest string) error {
+	var localpath string
+	source := url
+	switch {
+	case offlineDir != "":
+		localpath = offlinePath(url)
+		source = localpath
+		log.Printf("Copy offline file: %v -> %v", localpath, path)
+	case strings.HasPrefix(url, "file://"):
+		localpath = url[len("file://"):]
+		fallthrough
+	default:
+		log.Printf("Download file: %v -> %v", url, path)
+	}
+
+	// Download into a file with .tmp extension, so that we won't
+	// overwrite a file until it's downloaded fully
+	var d []byte
+	var err error
+	if localpath != "" {
+		d, err = copyFileHashed(path+".tmp", localpath)
 	} else {
-		// Get file over HTTP
-		c := http.Client{
-			Transport: &http.Transport{Proxy: http.ProxyFromEnvironment},
-		}
-		resp, err := c.Get(url)
-		if err != nil {
-			return err
+		d, err = httpDownload(url, path+".tmp")
+	}
+	if err != nil {
+		return err
+	}
+	if digest != "" {
+		if !strings.EqualFold(hex.EncodeToString(d), digest) {
+			os.Remove(path + ".tmp")
+			return fmt.Errorf("SHA256 verification failed: " +
+				"corrupt digest")
 		}
-		defer resp.Body.Close()
+		log.Printf("Verified SHA256: %v", path)
+	}
+
+	// Rename the tmp file back to the original file
+	err = os.Rename(path+".tmp", path)
+	if err != nil {
+		return err
+	}
+	recordDownload(source)
+
+	return nil
+}
+
+// recordDownload records where a file was downloaded or copied from.
+func recordDownload(source string) {
+	downloadedMtx.Lock()
+	downloadedURIs = append(downloadedURIs, source)
+	downloadedMtx.Unlock()
+}
+
+// scratch keeps track of the temporary directories so that they can be
+// removed on exit, including when interrupted.
+var scratch struct {
+	sync.Mutex
+	dirs []string
+}
+
+// scratchDir creates a temporary directory that is removed on exit.
+func scratchDir() (string, error) {
+	return newScratchDir("", "dcrinstall")
+}
 
-		if resp.StatusCode != http.StatusOK {
-			return fmt.Errorf("%v %v", resp.StatusCode,
-				http.StatusText(resp.StatusCode))
+// newScratchDir creates a temporary directory in parent, or in the default
+// directory for temporary files if parent is empty, that is removed on exit.
+func newScratchDir(parent, pattern string) (string, error) {
+	dir, err := os.MkdirTemp(parent, pattern)
+	if err != nil {
+		return "", fmt.Errorf("Create temporary file: %v", err)
+	}
+
+	scratch.Lock()
+	scratch.dirs = append(scratch.dirs, dir)
+	scratch.Unlock()
+
+	return dir, nil
+}
+
+// removeScratchDir removes a temporary directory created by scratchDir.
+func removeScratchDir(dir string) {
+	scratch.Lock()
+	defer scratch.Unlock()
+
+	for k := range scratch.dirs {
+		if scratch.dirs[k] == dir {
+			scratch.dirs = append(scratch.dirs[:k],
+				scratch.dirs[k+1:]...)
+			break
 		}
+	}
+	os.RemoveAll(dir)
+}
 
-		// Create our bytes counter and pass it to be used alongside
-		// our writer
-		counter := &WriteCounter{}
-		_, err = io.Copy(out, io.TeeReader(resp.Body, counter))
-		if err != nil {
-			return err
+// removeScratchDirs removes all temporary directories created by
+// scratchDir.
+func removeScratchDirs() {
+	scratch.Lock()
+	defer scratch.Unlock()
+
+	for _, dir := range scratch.dirs {
+		os.RemoveAll(dir)
+	}
+	scratch.dirs = nil
+}
+
+// truncatedError is returned when a download ends before all the bytes
+// announced by the server were received.
+type truncatedError struct {
+	received int64
+	expected int64
+}
+
+// Error satisfies the error interface for truncatedError.
+func (e truncatedError) Error() string {
+	return fmt.Sprintf("download truncated: received %v of %v bytes",
+		e.received, e.expected)
+}
+
+// httpDownload downloads url to filename and returns the sha256 digest of the
+// downloaded file. An existing filename is treated as the partial result of an
+// earlier attempt and the download resumes where it left off. Failed attempts
+// are retried with exponential backoff.
+func httpDownload(url, filename string) ([]byte, error) {
+	c := http.Client{
+		Transport: &http.Transport{Proxy: http.ProxyFromEnvironment},
+	}
+
+	backoff := retryBackoff
+	for attempt := 0; ; attempt++ {
+		h := sha256.New()
+		retry, err := httpDownloadAttempt(&c, url, filename, h)
+		if err == nil {
+			return h.Sum(nil), nil
+		}
+		if !retry || attempt >= retries {
+			return nil, err
 		}
 
-		// The progress use the same line so print a new line once it's
-		// finished downloading
-		if !quiet {
-			fmt.Println()
+		log.Printf("Download failed, retrying in %v: %v", backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
 		}
 	}
+}
 
-	// Close file because windows
-	out.Close()
+// httpDownloadAttempt makes a single attempt to download url to filename,
+// resuming from the current size of filename using a Range request. The
+// complete file, including what was downloaded earlier, is written to h. It
+// returns whether a failed attempt is worth retrying.
+func httpDownloadAttempt(c *http.Client, url, filename string,
+	h hash.Hash) (bool, error) {
 
-	// Rename the tmp file back to the original file
-	err = os.Rename(path+".tmp", path)
+	out, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0666)
 	if err != nil {
+		return false, err
+	}
+	defer out.Close()
+
+	// Hash what was downloaded earlier, which leaves the file offset at
+	// the end of the file.
+	offset, err := io.Copy(h, out)
+	if err != nil {
+		return false, err
+	}
+
+	// restart truncates the file to start the download over.
+	restart := func() error {
+		h.Reset()
+		err := out.Truncate(0)
+		if err != nil {
+			return err
+		}
+		_, err = out.Seek(0, io.SeekStart)
 		return err
 	}
 
-	return nil
+	// Abort the request when no data is received for a while.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stall := time.AfterFunc(stallTimeout, cancel)
+	defer stall.Stop()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%v-", offset))
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		var start int64
+		cr := resp.Header.Get("Content-Range")
+		_, err := fmt.Sscanf(cr, "bytes %d-", &start)
+		if err != nil || start != offset {
+			err = restart()
+			if err != nil {
+				return false, err
+			}
+			return true, fmt.Errorf("unexpected Content-Range: %v",
+				cr)
+		}
+		log.Printf("Resume download at %v",
+			humanize.Bytes(uint64(offset)))
+	case http.StatusOK:
+		// The server ignored the Range request, start over.
+		if offset > 0 {
+			err = restart()
+			if err != nil {
+				return false, err
+			}
+			offset = 0
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The partial file does not belong to the file on the
+		// server, start over.
+		err = restart()
+		if err != nil {
+			return false, err
+		}
+		return true, fmt.Errorf("%v %v", resp.StatusCode,
+			http.StatusText(resp.StatusCode))
+	default:
+		retry := resp.StatusCode >= http.StatusInternalServerError ||
+			resp.StatusCode == http.StatusTooManyRequests
+		return retry, fmt.Errorf("%v %v", resp.StatusCode,
+			http.StatusText(resp.StatusCode))
+	}
+
+	// Create our bytes counter and pass it to be used alongside our
+	// writer
+	counter := &WriteCounter{
+		Name:  strings.TrimSuffix(filepath.Base(filename), ".tmp"),
+		Total: uint64(offset),
+		Stall: stall,
+	}
+	progress.start(counter.Name)
+	n, err := io.Copy(io.MultiWriter(out, h),
+		io.TeeReader(resp.Body, counter))
+	progress.done(counter.Name)
+
+	if resp.ContentLength >= 0 && n != resp.ContentLength {
+		return true, truncatedError{
+			received: offset + n,
+			expected: offset + resp.ContentLength,
+		}
+	}
+	if err != nil {
+		return true, err
+	}
+
+	return false, nil
 }
 
-// pgpVerify verifies the signature with the provided key.
-func pgpVerify(signature, manifest, key string) error {
+// pgpVerify verifies the detached armored signature of manifest with the
+// trust roots.
+func pgpVerify(signature, manifest string) error {
 	log.Printf("PGP verify: %v", manifest)
 
+	keyring, err := trustedKeys()
+	if err != nil {
+		return err
+	}
+
 	// open manifest signature
 	sf, err := os.Open(signature)
 	if err != nil {
 		return err
 	}
 	defer sf.Close()
-
-	// open manifest
-	mf, err := os.Open(manifest)
+	block, err := armor.Decode(sf)
+	if err != nil {
+		return err
+	}
+	if block.Type != openpgp.SignatureType {
+		return fmt.Errorf("not a PGP signature: %v", block.Type)
+	}
+	sig, err := io.ReadAll(block.Body)
 	if err != nil {
 		return err
 	}
-	defer mf.Close()
 
-	// create keyring
-	br := bytes.NewBufferString(key)
-	keyring, err := openpgp.ReadArmoredKeyRing(br)
+	// open manifest
+	mf, err := os.Open(manifest)
 	if err != nil {
 		return err
 	}
+	defer mf.Close()
 
 	// verify signature
-	_, err = openpgp.CheckArmoredDetachedSignature(keyring, mf, sf)
+	_, err = verifyTrusted(keyring, mf, sig)
 	return err
 }
 
-func pgpVerifyAttached(file, key string) error {
+// pgpVerifyAttached verifies the clear signed file with the trust roots.
+func pgpVerifyAttached(file string) error {
 	log.Printf("PGP attached verify: %v", file)
 
-	// open manifest signature
-	data, err := os.ReadFile(file)
+	keyring, err := trustedKeys()
 	if err != nil {
 		return err
 	}
-	b, _ := clearsign.Decode(data)
-	if b == nil {
-		return fmt.Errorf("PGP attached signature failed")
-	}
 
-	// create keyring
-	br := bytes.NewBufferString(key)
-	keyring, err := openpgp.ReadArmoredKeyRing(br)
+	// open manifest signature
+	data, err := os.ReadFile(file)
 	if err != nil {
 		return err
 	}
-
-	// verify signature
-	_, err = openpgp.CheckDetachedSignature(keyring, bytes.NewReader(b.Bytes),
-		b.ArmoredSignature.Body)
+	b, err := decodeClearSigned(data)
 	if err != nil {
-		return err
+		return fmt.Errorf("PGP attached signature failed: %v", err)
 	}
 
-	return nil
+	// verify signature
+	_, err = verifyClearSigned(keyring, b)
+	return err
 }
 
 // findOS iterates over the entire manifest and plucks out the digest and
@@ -275,11 +722,15 @@ func findOS(which, manifest string) (string, string, error) {
 	defer f.Close()
 
 	br := bufio.NewReader(f)
-	i := 1
-	for {
+	for i := 1; ; i++ {
 		line, err := br.ReadString('\n')
 		if errors.Is(err, io.EOF) {
-			break
+			// A final line without a newline is still an entry.
+			if strings.TrimSpace(line) == "" {
+				break
+			}
+		} else if err != nil {
+			return "", "", err
 		}
 		line = strings.TrimSpace(line)
 
@@ -331,7 +782,7 @@ func sha256Verify(filename, digest string) error {
 	if err != nil {
 		return err
 	}
-	if hex.EncodeToString(d) != digest {
+	if !strings.EqualFold(hex.EncodeToString(d), digest) {
 		return fmt.Errorf("corrupt digest")
 	}
 	return nil
@@ -348,15 +799,17 @@ func unzip(src string, dest string) ([]string, error) {
 	}
 	defer r.Close()
 
+	if len(r.File) > maxExtractFiles {
+		return filenames, fmt.Errorf("%w: more than %v entries",
+			errArchiveFiles, maxExtractFiles)
+	}
+	var size uint64
 	for _, f := range r.File {
-		// Store filename/path for returning and using later on
-		fpath := filepath.Join(dest, f.Name)
-
-		// Check for ZipSlip. More Info: http://bit.ly/2MsjAWE
-		if !strings.HasPrefix(fpath, filepath.Clean(dest)+
-			string(os.PathSeparator)) {
-			return filenames, fmt.Errorf("%s: illegal file path",
-				fpath)
+		// Store filename/path for returning and using later on. Check
+		// for ZipSlip. More Info: http://bit.ly/2MsjAWE
+		fpath, err := archivePath(dest, f.Name, f.FileInfo().IsDir())
+		if err != nil {
+			return filenames, err
 		}
 		log.Printf("Extracting: %v", f.Name)
 
@@ -364,27 +817,47 @@ func unzip(src string, dest string) ([]string, error) {
 
 		if f.FileInfo().IsDir() {
 			// Make Folder
-			os.MkdirAll(fpath, os.ModePerm)
+			os.MkdirAll(fpath, 0755)
 			continue
 		}
+		if f.Mode()&os.ModeSymlink != 0 {
+			return filenames, fmt.Errorf("%w: %v", errArchiveLink,
+				f.Name)
+		}
+		if !f.Mode().IsRegular() {
+			return filenames, fmt.Errorf("%w: %v (mode %v)",
+				errArchiveType, f.Name, f.Mode())
+		}
+		size += f.UncompressedSize64
+		if size > maxExtractSize {
+			return filenames, fmt.Errorf("%w: more than %v bytes",
+				errArchiveSize, int64(maxExtractSize))
+		}
 
 		// Make File
-		if err = os.MkdirAll(filepath.Dir(fpath), os.ModePerm); err != nil {
+		if err = os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
 			return filenames, err
 		}
 
+		mode := archiveMode(int64(f.Mode().Perm()))
 		outFile, err := os.OpenFile(fpath,
-			os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
+			os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
 		if err != nil {
 			return filenames, err
 		}
 
 		rc, err := f.Open()
 		if err != nil {
+			outFile.Close()
 			return filenames, err
 		}
 
+		// The zip reader fails if the file is larger than its
+		// header claims.
 		_, err = io.Copy(outFile, rc)
+		if err == nil {
+			err = outFile.Chmod(mode)
+		}
 
 		// Close the file without defer to close before next iteration
 		// of loop
@@ -398,76 +871,62 @@ func unzip(src string, dest string) ([]string, error) {
 	return filenames, nil
 }
 
-// gunzip untars filename to destination.
-func gunzip(filename, destination string) error {
-	a, err := os.ReadFile(filename)
+// extract extracts the provided archive to the provided destination. The
+// archive format is detected from its content. The archive is streamed into a
+// staging directory in the destination and the extracted entries are only
+// moved into place once the whole archive extracted successfully, so a failed
+// extraction never leaves a partially extracted bundle behind.
+func extract(filename, dst string) error {
+	format, err := detectArchive(filename)
+	if err != nil {
+		return err
+	}
+	log.Printf("Extracting: %v (%v) -> %v\n", filename, format, dst)
+	if format == formatUnknown {
+		return fmt.Errorf("Unknown archive type: %v",
+			filepath.Base(filename))
+	}
+
+	staging, err := newScratchDir(dst, ".dcrinstall-staging")
+	if err != nil {
+		return err
+	}
+	defer removeScratchDir(staging)
+
+	if format == formatZip {
+		_, err = unzip(filename, staging)
+	} else {
+		err = untarFile(filename, staging, format)
+	}
 	if err != nil {
 		return err
 	}
-	ab := bytes.NewReader(a)
-	gz, err := gzip.NewReader(ab)
+
+	return promoteStaged(staging, dst)
+}
+
+// promoteStaged moves the entries of the staging directory into dst. An
+// existing entry, such as a bundle that was extracted before, is replaced.
+func promoteStaged(staging, dst string) error {
+	entries, err := os.ReadDir(staging)
 	if err != nil {
 		return err
 	}
-	defer gz.Close()
-	tr := tar.NewReader(gz)
-	for {
-		hdr, err := tr.Next()
+	for _, e := range entries {
+		target := filepath.Join(dst, e.Name())
+		err = os.RemoveAll(target)
 		if err != nil {
-			if errors.Is(err, io.EOF) {
-				break // end of archive
-			}
 			return err
 		}
-		if hdr == nil {
-			continue
-		}
-		log.Printf("Extracting: %v", hdr.Name)
-		target := filepath.Join(destination, hdr.Name)
-		switch hdr.Typeflag {
-		case tar.TypeDir:
-			if err := os.MkdirAll(target, 0755); err != nil {
-				return err
-			}
-		case tar.TypeReg:
-			f, err := os.OpenFile(target, os.O_CREATE|os.O_RDWR,
-				os.FileMode(hdr.Mode))
-			if err != nil {
-				return err
-			}
-
-			// copy to file
-			if _, err := io.Copy(f, tr); err != nil {
-				f.Close()
-				return err
-			}
-
-			if err := f.Close(); err != nil {
-				return err
-			}
+		err = os.Rename(filepath.Join(staging, e.Name()), target)
+		if err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
 
-// extract extracts the provided archive to the provided destination. It
-// autodetects if it is a zip or a tar archive.
-func extract(filename, dst string) error {
-	log.Printf("Extracting: %v -> %v\n", filename, dst)
-	var err error
-	archive := filepath.Ext(filename)
-	switch archive {
-	case ".zip":
-		_, err = unzip(filename, dst)
-	case ".gz":
-		err = gunzip(filename, dst)
-	default:
-		err = fmt.Errorf("Unknown archive type: %v", archive)
-	}
-	return err
-}
-
 // exists return true if the provided path exists.
 func exists(path string) bool {
 	_, err := os.Stat(path)
@@ -510,17 +969,3 @@ func printConfigError(installedConfigs, notInstalledConfigs []string) string {
 	}
 	return rv
 }
-
-// seenBefore looks to see if bundle has been extracted before.
-func seenBefore(bundle string) bool {
-	b := filepath.Base(bundle)
-	switch {
-	case strings.HasSuffix(bundle, ".zip"):
-		return exists((filepath.Join(destination,
-			strings.TrimSuffix(b, ".zip"))))
-	case strings.HasSuffix(bundle, ".tar.gz"):
-		return exists((filepath.Join(destination,
-			strings.TrimSuffix(b, ".tar.gz"))))
-	}
-	return false
-}
@@ -0,0 +1,174 @@
+// Copyright (c) 2022 The Decred developers
+// Use of this source code is governed by an ISC license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestHTTPDownloadAttempt ensures downloads resume from a partial file when
+// the server supports it and start over when it doesn't.
+func TestHTTPDownloadAttempt(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 64)
+
+	// serveContent serves data and honors Range requests.
+	serveContent := func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file", time.Time{},
+			bytes.NewReader(data))
+	}
+
+	tests := []struct {
+		name    string
+		partial string // Content of the partial file
+		handler http.HandlerFunc
+		rng     string // Expected Range header
+		want    []byte // Expected content of the file
+		retry   bool
+		err     bool
+	}{{
+		name:    "download",
+		handler: serveContent,
+		want:    data,
+	}, {
+		name:    "resume",
+		partial: string(data[:100]),
+		handler: serveContent,
+		rng:     "bytes=100-",
+		want:    data,
+	}, {
+		name:    "range ignored",
+		partial: "garbage",
+		handler: func(w http.ResponseWriter, r *http.Request) {
+			w.Write(data)
+		},
+		rng:  "bytes=7-",
+		want: data,
+	}, {
+		name:    "range not satisfiable",
+		partial: string(data) + "garbage",
+		handler: serveContent,
+		rng:     fmt.Sprintf("bytes=%v-", len(data)+7),
+		want:    []byte{},
+		retry:   true,
+		err:     true,
+	}, {
+		name:    "wrong content range",
+		partial: string(data[:100]),
+		handler: func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Range", fmt.Sprintf(
+				"bytes 0-%v/%v", len(data)-1, len(data)))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(data)
+		},
+		rng:   "bytes=100-",
+		want:  []byte{},
+		retry: true,
+		err:   true,
+	}, {
+		name: "not found",
+		handler: func(w http.ResponseWriter, r *http.Request) {
+			http.NotFound(w, r)
+		},
+		want: []byte{},
+		err:  true,
+	}, {
+		name: "unavailable",
+		handler: func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		},
+		want:  []byte{},
+		retry: true,
+		err:   true,
+	}}
+	for _, test := range tests {
+		var rng string
+		ts := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				rng = r.Header.Get("Range")
+				test.handler(w, r)
+			}))
+
+		filename := filepath.Join(t.TempDir(), "file.tmp")
+		if test.partial != "" {
+			writeTestFile(t, filename, test.partial)
+		}
+		h := sha256.New()
+		retry, err := httpDownloadAttempt(ts.Client(), ts.URL, filename,
+			h)
+		ts.Close()
+
+		if (err != nil) != test.err {
+			t.Errorf("%v: got error %v, want error %v", test.name,
+				err, test.err)
+		}
+		if retry != test.retry {
+			t.Errorf("%v: got retry %v, want %v", test.name, retry,
+				test.retry)
+		}
+		if rng != test.rng {
+			t.Errorf("%v: got Range %q, want %q", test.name, rng,
+				test.rng)
+		}
+		got, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, test.want) {
+			t.Errorf("%v: got %v bytes, want %v bytes", test.name,
+				len(got), len(test.want))
+		}
+		if test.err {
+			continue
+		}
+		if digest := sha256.Sum256(data); !bytes.Equal(h.Sum(nil),
+			digest[:]) {
+
+			t.Errorf("%v: digest does not match", test.name)
+		}
+	}
+}
+
+// TestHTTPDownloadTruncated ensures a download that ends before the announced
+// length is reported as truncated and keeps what was received for a resume.
+func TestHTTPDownloadTruncated(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Length", "100")
+			w.Write([]byte(strings.Repeat("x", 40)))
+		}))
+	defer ts.Close()
+
+	filename := filepath.Join(t.TempDir(), "file.tmp")
+	retry, err := httpDownloadAttempt(ts.Client(), ts.URL, filename,
+		sha256.New())
+	var terr truncatedError
+	if !errors.As(err, &terr) {
+		t.Fatalf("got error %v, want truncated", err)
+	}
+	if terr.received != 40 || terr.expected != 100 {
+		t.Errorf("got %v of %v bytes, want 40 of 100", terr.received,
+			terr.expected)
+	}
+	if !retry {
+		t.Errorf("truncated download not retried")
+	}
+	fi, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() != 40 {
+		t.Errorf("partial file: got %v bytes, want 40", fi.Size())
+	}
+}
@@ -5,6 +5,8 @@ go 1.17
 require (
 	github.com/decred/dcrd/dcrutil/v4 v4.0.0
 	github.com/dustin/go-humanize v1.0.0
+	github.com/klauspost/compress v1.15.15
+	github.com/ulikunitz/xz v0.5.11
 	golang.org/x/crypto v0.0.0-20220817201139-bc19a97f63c8
 	golang.org/x/sys v0.6.0
 )